@@ -0,0 +1,390 @@
+// geecache-cli 是 geecache 节点的命令行管理工具，通过节点的 HTTP 接口读写缓存、查看 group 与统计信息。
+//
+// 用法：
+//
+//	geecache-cli [flags] get <key>
+//	geecache-cli [flags] set <key> <value>    value 为 - 时从标准输入读取
+//	geecache-cli [flags] delete <key>
+//	geecache-cli [flags] groups
+//	geecache-cli [flags] stats [group]
+//	geecache-cli [flags] owner <key>
+//
+// set 与 delete 由 -node 指定的节点通过 Group.Set 与 Group.Remove 转发给所属节点，结果与节点自己的写入和删除相同。
+// owner 只是在本地按默认的一致性哈希重放节点列表，节点使用了其他 Picker、虚拟节点倍数不同、
+// 或节点列表与运行中的节点不一致时，结果可能与实际的所属节点不同。
+//
+// 节点列表、默认 group、签名密钥与 TLS 证书可以写在 -config 指定的 JSON 文件中，命令行参数优先。
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"geecache"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 与 geecache.HTTPPool 的默认值保持一致
+const (
+	defaultBasePath  = "/geeCache/"
+	defaultStatsPath = "/geeCacheStats/"
+	defaultReplicas  = 50
+)
+
+// config 是 -config 指定的配置文件的内容
+type config struct {
+	Peers       []string `json:"peers"`       // 所有节点的地址，与节点 HTTPPool.Set 传入的相同
+	Node        string   `json:"node"`        // 发送 get、groups、stats 请求的节点，默认为第一个节点
+	Group       string   `json:"group"`       // 默认的 group
+	Replicas    int      `json:"replicas"`    // 一致性哈希的虚拟节点倍数，需与节点相同
+	Replication int      `json:"replication"` // 每个 key 保存在几个节点上，需与节点的 WithReplication 相同
+	Name        string   `json:"name"`        // 签名时使用的身份，使用 WithPeerKeys 时需在节点的 keys 中
+	Secret      string   `json:"secret"`      // 签名密钥，为空表示不签名
+	Cert        string   `json:"cert"`        // 以下为双向 TLS 使用的证书
+	Key         string   `json:"key"`
+	CA          string   `json:"ca"`
+	Timeout     string   `json:"timeout"` // 单个请求的超时时间，例如 "2s"
+}
+
+// loadConfig 读取 JSON 配置文件，path 为空时返回空配置
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	if path == "" {
+		return cfg, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// client 向节点发送请求
+type client struct {
+	cfg  *config
+	http *http.Client
+}
+
+func newClient(cfg *config) (*client, error) {
+	if cfg.Node == "" && len(cfg.Peers) > 0 {
+		cfg.Node = cfg.Peers[0]
+	}
+	if cfg.Node == "" {
+		return nil, errors.New("no node given, use -node, -peers or -config")
+	}
+	if cfg.Replicas <= 0 {
+		cfg.Replicas = defaultReplicas
+	}
+	if cfg.Name == "" {
+		cfg.Name = "geecache-cli"
+	}
+	timeout := 5 * time.Second
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("bad timeout: %v", err)
+		}
+		timeout = d
+	}
+	c := &client{cfg: cfg, http: &http.Client{Timeout: timeout}}
+	if cfg.Cert != "" {
+		tlsConfig, err := geecache.MutualTLSConfig(cfg.Cert, cfg.Key, cfg.CA)
+		if err != nil {
+			return nil, err
+		}
+		c.http.Transport = &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}
+	} else if cfg.CA != "" {
+		return nil, errors.New("ca is only used together with cert and key")
+	}
+	return c, nil
+}
+
+// do 发送请求并返回状态码与 body，开启签名时先对请求签名
+func (c *client) do(method, u string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+	if c.cfg.Secret != "" {
+		geecache.SignRequest(req, c.cfg.Name, []byte(c.cfg.Secret), body)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		return 0, nil, fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(b)))
+	}
+	return res.StatusCode, b, nil
+}
+
+func keyURL(node, group, key string) string {
+	return fmt.Sprintf("%s%s%s/%s", node, defaultBasePath, url.QueryEscape(group), url.QueryEscape(key))
+}
+
+// decode 解析 do 返回的 protobuf Response，非 200 时返回其中的错误
+func decode(code int, b []byte, err error) (*pb.Response, error) {
+	if err != nil {
+		return nil, err
+	}
+	res := &pb.Response{}
+	if err := proto.Unmarshal(b, res); err != nil {
+		return nil, fmt.Errorf("unexpected response (%d): %s", code, strings.TrimSpace(string(b)))
+	}
+	if res.GetNotFound() {
+		return nil, errors.New("not found")
+	}
+	if code != http.StatusOK {
+		return nil, fmt.Errorf("server returned %d: %s", code, res.GetError())
+	}
+	return res, nil
+}
+
+// owners 在本地按默认的一致性哈希重建节点的哈希环，返回 key 的所属节点，开启复制时依次返回所有副本。
+// 节点使用 WithPicker 选择了其他策略时结果不准确
+func (c *client) owners(key string) []string {
+	if len(c.cfg.Peers) == 0 {
+		return []string{c.cfg.Node}
+	}
+	ring := consistenthash.New(c.cfg.Replicas, nil)
+	ring.Add(c.cfg.Peers...)
+	if c.cfg.Replication > 1 {
+		return consistenthash.GetN(ring, key, c.cfg.Replication)
+	}
+	return []string{ring.Get(key)}
+}
+
+// get 由 Node 获取值，Node 会按一致性哈希转发给所属节点
+func (c *client) get(group, key string) ([]byte, error) {
+	body, err := proto.Marshal(&pb.Request{Group: group, Key: key})
+	if err != nil {
+		return nil, err
+	}
+	res, err := decode(c.do(http.MethodGet, keyURL(c.cfg.Node, group, key), body))
+	if err != nil {
+		return nil, err
+	}
+	return res.GetValue(), nil
+}
+
+// set 以 POST 请求将值发送给 Node，由 Node 通过 Group.Set 转发给所属节点并写入副本
+func (c *client) set(group, key string, value []byte) error {
+	body, err := proto.Marshal(&pb.Request{Group: group, Key: key, Value: value})
+	if err != nil {
+		return err
+	}
+	_, err = decode(c.do(http.MethodPost, keyURL(c.cfg.Node, group, key), body))
+	return err
+}
+
+// delete 以 forward 的 DELETE 请求通知 Node，由 Node 通过 Group.Remove 先删除所属节点上的值，再删除其余节点上的副本
+func (c *client) delete(group, key string) error {
+	body, err := proto.Marshal(&pb.Request{Group: group, Key: key, Forward: true})
+	if err != nil {
+		return err
+	}
+	_, err = decode(c.do(http.MethodDelete, keyURL(c.cfg.Node, group, key), body))
+	return err
+}
+
+// stats 返回 group 的统计信息，group 为空时返回所有 group 的统计信息
+func (c *client) stats(group string) (json.RawMessage, error) {
+	code, b, err := c.do(http.MethodGet, c.cfg.Node+defaultStatsPath+url.QueryEscape(group), nil)
+	if err != nil {
+		return nil, err
+	}
+	if code != http.StatusOK {
+		return nil, fmt.Errorf("server returned %d: %s", code, strings.TrimSpace(string(b)))
+	}
+	return b, nil
+}
+
+// groups 返回 Node 上所有 group 的名称
+func (c *client) groups() ([]string, error) {
+	b, err := c.stats("")
+	if err != nil {
+		return nil, err
+	}
+	var stats map[string]json.RawMessage
+	if err := json.Unmarshal(b, &stats); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// run 执行一条命令，输出写入 w，提示信息写入 stderr
+func run(cfg *config, args []string, stdin io.Reader, w, stderr io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("no command given")
+	}
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	cmd, args := args[0], args[1:]
+	need := func(n int, usage string) error {
+		if len(args) != n {
+			return fmt.Errorf("usage: %s %s", cmd, usage)
+		}
+		if cmd != "owner" && cfg.Group == "" {
+			return errors.New("no group given, use -group or -config")
+		}
+		return nil
+	}
+
+	switch cmd {
+	case "get":
+		if err := need(1, "<key>"); err != nil {
+			return err
+		}
+		v, err := c.get(cfg.Group, args[0])
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", v)
+		return err
+	case "set":
+		if err := need(2, "<key> <value|->"); err != nil {
+			return err
+		}
+		value := []byte(args[1])
+		if args[1] == "-" {
+			if value, err = ioutil.ReadAll(stdin); err != nil {
+				return err
+			}
+		}
+		return c.set(cfg.Group, args[0], value)
+	case "delete":
+		if err := need(1, "<key>"); err != nil {
+			return err
+		}
+		return c.delete(cfg.Group, args[0])
+	case "groups":
+		names, err := c.groups()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Fprintln(w, name)
+		}
+		return nil
+	case "stats":
+		group := cfg.Group
+		if len(args) > 0 {
+			group = args[0]
+		}
+		b, err := c.stats(group)
+		if err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, b, "", "  "); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, out.String())
+		return err
+	case "owner":
+		if err := need(1, "<key>"); err != nil {
+			return err
+		}
+		fmt.Fprintln(stderr, "geecache-cli: owner replays the default consistent hash ring locally, "+
+			"it may differ from the nodes if they use another picker or peer list")
+		for i, owner := range c.owners(args[0]) {
+			if i == 0 {
+				fmt.Fprintln(w, owner)
+			} else {
+				fmt.Fprintf(w, "%s (replica)\n", owner)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+func main() {
+	var (
+		configFile  string
+		node        string
+		peers       string
+		group       string
+		secret      string
+		replication int
+	)
+	flag.StringVar(&configFile, "config", "", "JSON config file with peers, group, secret and TLS certificates")
+	flag.StringVar(&node, "node", "", "Node to send requests to, defaults to the first peer")
+	flag.StringVar(&peers, "peers", "", "Comma separated peer addresses, or @file listing one address per line")
+	flag.StringVar(&group, "group", "", "Group name")
+	flag.StringVar(&secret, "secret", os.Getenv("GEECACHE_SECRET"), "Shared secret used to sign requests")
+	flag.IntVar(&replication, "replication", 0, "Number of nodes each key is stored on")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s [flags] get <key> | set <key> <value|-> | delete <key> | groups | stats [group] | owner <key>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if strings.HasPrefix(peers, "@") {
+		list, err := geecache.FilePeers(peers[1:]).Peers()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg.Peers = list
+	} else if peers != "" {
+		cfg.Peers = strings.Split(peers, ",")
+	}
+	if node != "" {
+		cfg.Node = node
+	}
+	if group != "" {
+		cfg.Group = group
+	}
+	if secret != "" {
+		cfg.Secret = secret
+	}
+	if replication > 0 {
+		cfg.Replication = replication
+	}
+
+	if err := run(cfg, flag.Args(), os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "geecache-cli:", err)
+		if flag.NArg() == 0 {
+			flag.Usage()
+		}
+		os.Exit(1)
+	}
+}
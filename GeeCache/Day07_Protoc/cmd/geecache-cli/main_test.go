@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"geecache"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// startNodes 启动 n 个开启了签名的节点，返回它们的地址
+func startNodes(t *testing.T, n int, secret string) []string {
+	var (
+		addrs   []string
+		servers []*httptest.Server
+	)
+	for i := 0; i < n; i++ {
+		s := httptest.NewUnstartedServer(nil)
+		addrs = append(addrs, "http://"+s.Listener.Addr().String())
+		servers = append(servers, s)
+	}
+	for i, s := range servers {
+		pool := geecache.NewHTTPPool(addrs[i], geecache.WithSharedSecret([]byte(secret)))
+		pool.Set(addrs...)
+		s.Config.Handler = pool
+		s.Start()
+		t.Cleanup(s.Close)
+	}
+	return addrs
+}
+
+func TestRun(t *testing.T) {
+	geecache.NewGroup("cli", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "Tom" {
+				return []byte("630"), nil
+			}
+			return nil, &geecache.NotFoundError{Key: key}
+		}))
+	addrs := startNodes(t, 2, "secret")
+	cfg := func() *config {
+		return &config{Peers: addrs, Group: "cli", Secret: "secret"}
+	}
+	var stderr bytes.Buffer
+	exec := func(cfg *config, stdin string, args ...string) (string, error) {
+		var out bytes.Buffer
+		stderr.Reset()
+		err := run(cfg, args, strings.NewReader(stdin), &out, &stderr)
+		return out.String(), err
+	}
+
+	if out, err := exec(cfg(), "", "get", "Tom"); err != nil || out != "630\n" {
+		t.Fatalf("get Tom = %q, %v", out, err)
+	}
+	if _, err := exec(cfg(), "", "get", "unknown"); err == nil || err.Error() != "not found" {
+		t.Fatalf("get unknown should report not found, got %v", err)
+	}
+
+	// 所有节点共享同一个 Group，因此 set 之后从任意节点都能读到所有者上的值
+	if _, err := exec(cfg(), "700", "set", "Jack", "-"); err != nil {
+		t.Fatalf("set Jack failed: %v", err)
+	}
+	for _, node := range addrs {
+		c := cfg()
+		c.Node = node
+		if out, err := exec(c, "", "get", "Jack"); err != nil || out != "700\n" {
+			t.Fatalf("get Jack from %s = %q, %v", node, out, err)
+		}
+	}
+	// 只指定 -node 时，delete 也由该节点通过 Group.Remove 删除所有节点上的值
+	only := &config{Node: addrs[1], Group: "cli", Secret: "secret"}
+	if _, err := exec(only, "", "delete", "Jack"); err != nil {
+		t.Fatalf("delete Jack failed: %v", err)
+	}
+	for _, node := range addrs {
+		c := cfg()
+		c.Node = node
+		if _, err := exec(c, "", "get", "Jack"); err == nil {
+			t.Fatalf("Jack should be deleted on %s", node)
+		}
+	}
+
+	owner, err := exec(cfg(), "", "owner", "Tom")
+	if err != nil || (owner != addrs[0]+"\n" && owner != addrs[1]+"\n") {
+		t.Fatalf("owner Tom = %q, %v", owner, err)
+	}
+	if !strings.Contains(stderr.String(), "owner replays the default consistent hash ring") {
+		t.Fatalf("owner should warn on stderr, got %q", stderr.String())
+	}
+	c := cfg()
+	c.Replication = 2
+	if out, _ := exec(c, "", "owner", "Tom"); !strings.HasPrefix(out, owner) || !strings.Contains(out, "(replica)") {
+		t.Fatalf("owner with replication = %q", out)
+	}
+
+	if out, err := exec(cfg(), "", "groups"); err != nil || !strings.Contains(out, "cli\n") {
+		t.Fatalf("groups = %q, %v", out, err)
+	}
+	if out, err := exec(cfg(), "", "stats"); err != nil || !strings.Contains(out, `"name": "cli"`) {
+		t.Fatalf("stats = %q, %v", out, err)
+	}
+
+	unsigned := cfg()
+	unsigned.Secret = ""
+	if _, err := exec(unsigned, "", "get", "Tom"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("unsigned request should be rejected, got %v", err)
+	}
+	if _, err := exec(cfg(), "", "unknown"); err == nil {
+		t.Fatal("unknown command should fail")
+	}
+}
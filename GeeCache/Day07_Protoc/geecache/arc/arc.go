@@ -0,0 +1,285 @@
+package arc
+
+import (
+	"container/list"
+	"time"
+
+	"geecache/lru"
+)
+
+// Value 与 lru.Value 相同，使得各淘汰策略可以实现同一个接口
+type Value = lru.Value
+
+// Cache 是 ARC(Adaptive Replacement Cache) 缓存，按内存大小而非元素个数计算容量。
+// t1 保存只被访问过一次的元素，t2 保存被访问过多次的元素，b1、b2 分别记录从 t1、t2 淘汰的 key。
+// 当 b1 中的 key 再次被加入时说明 t1 太小，增大 t1 的目标大小 p；b2 命中时则减小 p，
+// 从而在 recency 与 frequency 之间自适应调整。
+type Cache struct {
+	maxBytes	int64		// 允许使用最大内存
+	p			int64		// t1 的目标内存大小
+	t1Bytes		int64		// t1 已经使用的内存
+	t2Bytes		int64		// t2 已经使用的内存
+	t1, t2		*list.List	// 实际保存值的两个队列，队首为最新的
+	b1, b2		*ghostList	// 只记录 key 的两个 ghost 队列
+	cache		map[string]*list.Element	// t1 与 t2 中的元素
+	OnEvicted	func(key string, value Value)	//	如果回调函数 OnEvicted 不为 nil，则调用回调函数。
+}
+
+type entry struct {
+	key		string
+	value	Value
+	expire	time.Time	// 过期时间，零值表示永不过期
+	inT2	bool		// 是否在 t2 队列中
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key)) + int64(e.value.Len())
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// now 便于测试时替换时间源
+var now = time.Now
+
+// New 实例化
+func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		t1:        list.New(),
+		t2:        list.New(),
+		b1:        newGhostList(),
+		b2:        newGhostList(),
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Get 查找 key，命中的元素移动到 t2 队首
+func (c *Cache) Get(key string) (val Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		if kv.expired(now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		c.moveToT2(ele)
+		return kv.value, true
+	}
+	return
+}
+
+// Add : add or modify
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 与 Add 相同，但会为 key 设置过期时间，expire 为零值时表示永不过期
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.addBytes(kv, int64(value.Len())-int64(kv.value.Len()))
+		kv.value = value
+		kv.expire = expire
+		c.moveToT2(ele)
+	} else {
+		kv := &entry{key: key, value: value, expire: expire}
+		size := kv.size()
+		switch {
+		case c.b1.contains(key):
+			// b1 命中，说明 t1 偏小
+			c.p = min64(c.maxBytes, c.p+size*max64(1, c.b2.bytes/max64(1, c.b1.bytes)))
+			c.b1.remove(key)
+			kv.inT2 = true
+			c.cache[key] = c.t2.PushFront(kv)
+		case c.b2.contains(key):
+			// b2 命中，说明 t2 偏小
+			c.p = max64(0, c.p-size*max64(1, c.b1.bytes/max64(1, c.b2.bytes)))
+			c.b2.remove(key)
+			kv.inT2 = true
+			c.cache[key] = c.t2.PushFront(kv)
+		default:
+			c.cache[key] = c.t1.PushFront(kv)
+		}
+		c.addBytes(kv, size)
+	}
+	for c.maxBytes != 0 && c.Bytes() > c.maxBytes {
+		c.RemoveOldest()
+	}
+	c.trimGhosts()
+}
+
+// SetMaxBytes 修改允许使用的最大内存，缩小时立即淘汰多出的元素并收缩 ghost 队列，0 表示不限制
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	c.p = min64(c.p, maxBytes)
+	for c.maxBytes != 0 && c.Bytes() > c.maxBytes {
+		c.RemoveOldest()
+	}
+	c.trimGhosts()
+}
+
+// RemoveOldest 按照目标大小 p 从 t1 或 t2 淘汰一个元素到对应的 ghost 队列
+func (c *Cache) RemoveOldest() {
+	if c.t1.Len() > 0 && (c.t1Bytes > c.p || c.t2.Len() == 0) {
+		ele := c.t1.Back()
+		kv := ele.Value.(*entry)
+		c.removeElement(ele)
+		c.b1.add(kv.key, kv.size())
+	} else if ele := c.t2.Back(); ele != nil {
+		kv := ele.Value.(*entry)
+		c.removeElement(ele)
+		c.b2.add(kv.key, kv.size())
+	}
+}
+
+// Remove 删除指定 key，返回 key 是否存在
+func (c *Cache) Remove(key string) bool {
+	c.b1.remove(key)
+	c.b2.remove(key)
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired 删除所有已过期的元素，返回删除的个数
+func (c *Cache) RemoveExpired() int {
+	cur := now()
+	removed := 0
+	for _, ele := range c.cache {
+		if ele.Value.(*entry).expired(cur) {
+			c.removeElement(ele)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Walk 先遍历 t1 再遍历 t2，每个队列都从最久未访问的元素开始。
+// 遍历过程中不能修改 Cache
+func (c *Cache) Walk(fn func(key string, value Value, expire time.Time)) {
+	for _, l := range []*list.List{c.t1, c.t2} {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			fn(kv.key, kv.value, kv.expire)
+		}
+	}
+}
+
+// Bytes 返回当前已经使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.t1Bytes + c.t2Bytes
+}
+
+// Len 返回元素个数
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+func (c *Cache) moveToT2(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.inT2 {
+		c.t2.MoveToFront(ele)
+		return
+	}
+	c.t1.Remove(ele)
+	c.t1Bytes -= kv.size()
+	kv.inT2 = true
+	c.cache[kv.key] = c.t2.PushFront(kv)
+	c.t2Bytes += kv.size()
+}
+
+func (c *Cache) addBytes(kv *entry, delta int64) {
+	if kv.inT2 {
+		c.t2Bytes += delta
+	} else {
+		c.t1Bytes += delta
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.inT2 {
+		c.t2.Remove(ele)
+	} else {
+		c.t1.Remove(ele)
+	}
+	c.addBytes(kv, -kv.size())
+	delete(c.cache, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// trimGhosts 限制 ghost 队列的大小：t1+b1 不超过 maxBytes，全部队列不超过 2*maxBytes
+func (c *Cache) trimGhosts() {
+	for c.b1.ll.Len() > 0 && c.t1Bytes+c.b1.bytes > c.maxBytes {
+		c.b1.removeOldest()
+	}
+	for c.b2.ll.Len() > 0 && c.Bytes()+c.b1.bytes+c.b2.bytes > 2*c.maxBytes {
+		c.b2.removeOldest()
+	}
+}
+
+// ghostList 是只记录 key 及其淘汰前大小的 LRU 队列
+type ghostList struct {
+	ll		*list.List
+	keys	map[string]*list.Element
+	bytes	int64
+}
+
+type ghostEntry struct {
+	key		string
+	size	int64
+}
+
+func newGhostList() *ghostList {
+	return &ghostList{ll: list.New(), keys: make(map[string]*list.Element)}
+}
+
+func (g *ghostList) contains(key string) bool {
+	_, ok := g.keys[key]
+	return ok
+}
+
+func (g *ghostList) add(key string, size int64) {
+	g.remove(key)
+	g.keys[key] = g.ll.PushFront(&ghostEntry{key: key, size: size})
+	g.bytes += size
+}
+
+func (g *ghostList) remove(key string) {
+	if ele, ok := g.keys[key]; ok {
+		g.removeElement(ele)
+	}
+}
+
+func (g *ghostList) removeOldest() {
+	if ele := g.ll.Back(); ele != nil {
+		g.removeElement(ele)
+	}
+}
+
+func (g *ghostList) removeElement(ele *list.Element) {
+	e := ele.Value.(*ghostEntry)
+	g.ll.Remove(ele)
+	delete(g.keys, e.key)
+	g.bytes -= e.size
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,71 @@
+package arc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestScanResistant(t *testing.T) {
+	// 每个元素占用 4 字节，最多容纳 10 个
+	c := New(int64(40), nil)
+	hot := []string{"h1", "h2", "h3", "h4", "h5"}
+	for _, k := range hot {
+		c.Add(k, String("vv"))
+		c.Get(k)
+	}
+
+	for i := 0; i < 100; i++ {
+		c.Add(fmt.Sprintf("s%d", i%100), String(fmt.Sprintf("%d", i%10)))
+	}
+
+	for _, k := range hot {
+		if _, ok := c.Get(k); !ok {
+			t.Fatalf("hot key %s should survive the scan", k)
+		}
+	}
+	if c.Bytes() > 40 {
+		t.Fatalf("used bytes %d exceed max bytes", c.Bytes())
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	c := New(int64(16), nil)
+	for _, k := range []string{"k1", "k2", "k3", "k4"} {
+		c.Add(k, String("vv"))
+	}
+	c.Get("k4")
+	c.Add("k5", String("vv"))
+	if !c.b1.contains("k1") {
+		t.Fatal("k1 should be recorded in b1")
+	}
+	// b1 命中时增大 t1 的目标大小
+	c.Add("k1", String("vv"))
+	if c.p == 0 || !c.cache["k1"].Value.(*entry).inT2 {
+		t.Fatalf("b1 hit should grow p and add k1 to t2, p: %d", c.p)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	cur := time.Now()
+	now = func() time.Time { return cur }
+	defer func() { now = time.Now }()
+
+	c := New(int64(0), nil)
+	c.AddWithExpire("k1", String("v1"), cur.Add(time.Second))
+	c.Add("k2", String("v2"))
+	c.Get("k1")
+	cur = cur.Add(time.Minute)
+	if _, ok := c.Get("k1"); ok || c.Len() != 1 {
+		t.Fatalf("k1 should expire, len: %d", c.Len())
+	}
+	if n := c.RemoveExpired(); n != 0 || c.Bytes() != 4 {
+		t.Fatalf("RemoveExpired removed %d, bytes: %d", n, c.Bytes())
+	}
+}
@@ -0,0 +1,201 @@
+package geecache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+HTTPPool 默认不做任何认证，任何能访问到节点端口的客户端都可以读取所有 group 的值。
+有两种可以同时使用的保护方式：
+
+  - WithTLS：节点间使用双向 TLS，请求方必须出示由指定 CA 签发的客户端证书，节点地址需以 https:// 开头；
+  - WithSharedSecret / WithPeerKeys：每个请求带上 HMAC-SHA256 签名，签名覆盖方法、路径、时间戳与 body。
+
+未通过认证的请求返回 401，不会读取或修改缓存。签名请求先校验请求头，通过后才读取 body，
+且 body 最多读取 defaultMaxBodyBytes，超过时返回 413。
+
+签名不包含随机数，节点也不记录已处理的请求，时间戳有效期内截获的请求可以被原样重放；
+签名也不加密内容，在不可信的网络中需要同时使用 WithTLS。
+*/
+
+const (
+	headerPeer      = "X-GeeCache-Peer"      // 发送请求的节点地址，用于选择校验签名的密钥
+	headerTimestamp = "X-GeeCache-Timestamp" // 签名时的 Unix 时间戳（秒）
+	headerSignature = "X-GeeCache-Signature" // 十六进制编码的 HMAC-SHA256 签名
+
+	defaultMaxClockSkew = 5 * time.Minute // 时间戳与本地时间相差超过该值的请求被拒绝，限制重放的时间窗口
+	defaultMaxBodyBytes = 64 << 20        // 校验签名时最多读取的 body 大小
+)
+
+var errUnauthorized = errors.New("unauthorized")
+
+// peerAuth 负责对节点间的请求签名与校验
+type peerAuth struct {
+	secret  []byte            // 所有节点共用的密钥
+	keys    map[string][]byte // 每个节点各自的密钥，以节点地址为 key
+	maxSkew time.Duration
+}
+
+// WithSharedSecret 使所有节点使用同一个密钥对请求签名
+func WithSharedSecret(secret []byte) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.authOrNew().secret = secret
+	}
+}
+
+// WithPeerKeys 为每个节点设置各自的密钥，以节点地址（与 Set 传入的相同）为 key。
+// 节点使用自己的密钥对发出的请求签名，接收方根据请求头中的节点地址选择密钥校验，
+// 因此每个节点都需要知道所有节点的密钥。同时设置了 WithSharedSecret 时，不在 keys 中的节点使用共享密钥
+func WithPeerKeys(keys map[string][]byte) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.authOrNew().keys = keys
+	}
+}
+
+// WithTLS 设置节点间的双向 TLS：config 用于请求其他节点，同时 ServeHTTP 只接受出示了已验证客户端证书的请求。
+// 节点需要通过 http.Server{TLSConfig: config} 的 ListenAndServeTLS 提供服务，config 可以由 MutualTLSConfig 创建
+func WithTLS(config *tls.Config) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.tlsConfig = config
+	}
+}
+
+// MutualTLSConfig 读取本节点的证书与 CA 证书，返回可同时用于服务端与客户端的双向 TLS 配置
+func MutualTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading key pair: %v", err)
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in %s", caFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func (p *HTTPPool) authOrNew() *peerAuth {
+	if p.auth == nil {
+		p.auth = &peerAuth{maxSkew: defaultMaxClockSkew}
+	}
+	return p.auth
+}
+
+// key 返回 peer 使用的签名密钥
+func (a *peerAuth) key(peer string) ([]byte, bool) {
+	if key, ok := a.keys[peer]; ok {
+		return key, true
+	}
+	return a.secret, len(a.secret) > 0
+}
+
+// sign 以 self 的身份对 req 签名，body 为请求的完整内容
+func (a *peerAuth) sign(req *http.Request, self string, body []byte) error {
+	key, ok := a.key(self)
+	if !ok {
+		return fmt.Errorf("no signing key for %s", self)
+	}
+	SignRequest(req, self, key, body)
+	return nil
+}
+
+// SignRequest 以 peer 的身份用 key 对 req 签名，供节点以外的客户端（例如管理工具）访问开启了签名的节点。
+// body 需与 req 的内容相同；使用 WithSharedSecret 时 peer 可以是任意名称
+func SignRequest(req *http.Request, peer string, key, body []byte) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(headerPeer, peer)
+	req.Header.Set(headerTimestamp, ts)
+	req.Header.Set(headerSignature, hex.EncodeToString(signature(key, req.Method, req.URL.EscapedPath(), peer, ts, body)))
+}
+
+// checkHeaders 在读取 body 之前校验请求头中的节点与时间戳，返回校验签名使用的密钥与签名
+func (a *peerAuth) checkHeaders(r *http.Request) (key, sig []byte, err error) {
+	peer := r.Header.Get(headerPeer)
+	key, ok := a.key(peer)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: unknown peer %q", errUnauthorized, peer)
+	}
+	sec, err := strconv.ParseInt(r.Header.Get(headerTimestamp), 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: bad timestamp", errUnauthorized)
+	}
+	if skew := time.Since(time.Unix(sec, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return nil, nil, fmt.Errorf("%w: timestamp out of range", errUnauthorized)
+	}
+	sig, err = hex.DecodeString(r.Header.Get(headerSignature))
+	if err != nil || len(sig) != sha256.Size {
+		return nil, nil, fmt.Errorf("%w: bad signature", errUnauthorized)
+	}
+	return key, sig, nil
+}
+
+// verify 校验 r 的签名，key 与 sig 由 checkHeaders 返回，body 为已读取的请求内容
+func verify(r *http.Request, key, sig, body []byte) error {
+	want := signature(key, r.Method, r.URL.EscapedPath(), r.Header.Get(headerPeer), r.Header.Get(headerTimestamp), body)
+	if !hmac.Equal(sig, want) {
+		return fmt.Errorf("%w: bad signature", errUnauthorized)
+	}
+	return nil
+}
+
+// signature 计算一个请求的 HMAC-SHA256 签名，body 只以摘要的形式参与计算
+func signature(key []byte, method, path, peer, ts string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n", method, path, peer, ts)
+	mac.Write(sum[:])
+	return mac.Sum(nil)
+}
+
+// authorize 检查请求是否来自可信的节点。请求头校验通过后才读取 body 校验签名，读取后会将其放回 r.Body。
+// 未通过认证时返回的错误包装了 errUnauthorized，body 超过 defaultMaxBodyBytes 时返回读取错误
+func (p *HTTPPool) authorize(w http.ResponseWriter, r *http.Request) error {
+	if p.tlsConfig != nil && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		return fmt.Errorf("%w: client certificate required", errUnauthorized)
+	}
+	if p.auth == nil {
+		return nil
+	}
+	key, sig, err := p.auth.checkHeaders(r)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	if r.Body != nil {
+		if body, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, defaultMaxBodyBytes)); err != nil {
+			return fmt.Errorf("reading body: %v", err)
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return verify(r, key, sig, body)
+}
+
+// do 发送请求，开启签名时先以本节点的身份签名，body 需与 req 的内容相同
+func (h *httpGetter) do(req *http.Request, body []byte) (*http.Response, error) {
+	if h.auth != nil {
+		if err := h.auth.sign(req, h.self, body); err != nil {
+			return nil, err
+		}
+	}
+	return h.client.Do(req)
+}
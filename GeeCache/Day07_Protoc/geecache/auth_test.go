@@ -0,0 +1,224 @@
+package geecache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	pb "geecache/geecachepb"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHTTPSignedRequests(t *testing.T) {
+	NewGroup("signed", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	secret := []byte("secret")
+	pool := NewHTTPPool("http://localhost:8001", WithSharedSecret(secret))
+	server := httptest.NewServer(pool)
+	defer server.Close()
+
+	getter := NewHTTPPool("http://localhost:8002", WithSharedSecret(secret)).newGetter(server.URL)
+	res := &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: "signed", Key: "Tom"}, res); err != nil || string(res.Value) != "Tom" {
+		t.Fatalf("signed get failed: %q, %v", res.Value, err)
+	}
+	if err := getter.Set(&pb.Request{Group: "signed", Key: "Tom", Value: []byte("630")}); err != nil {
+		t.Fatalf("signed set failed: %v", err)
+	}
+
+	for name, p := range map[string]*HTTPPool{
+		"unsigned":     NewHTTPPool("http://localhost:8002"),
+		"wrong secret": NewHTTPPool("http://localhost:8002", WithSharedSecret([]byte("wrong"))),
+	} {
+		err := p.newGetter(server.URL).Get(&pb.Request{Group: "signed", Key: "Tom"}, &pb.Response{})
+		if err == nil || err.Error() != "server returned: 401 Unauthorized" {
+			t.Fatalf("%s: expect 401, got %v", name, err)
+		}
+	}
+
+	// 篡改 body 后签名失效
+	req := httptest.NewRequest(http.MethodPut, defaultBasePath+"signed/Tom", nil)
+	pool.auth.sign(req, "http://localhost:8002", []byte("630"))
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered body should return 401, got %d", w.Code)
+	}
+
+	// 请求头校验失败时不读取 body；签名正确但 body 过大时返回 413
+	unread := &countingReader{}
+	req = httptest.NewRequest(http.MethodPut, defaultBasePath+"signed/Tom", unread)
+	w = httptest.NewRecorder()
+	pool.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || unread.n != 0 {
+		t.Fatalf("unsigned body should not be read, got %d after %d bytes", w.Code, unread.n)
+	}
+	big := &countingReader{limit: defaultMaxBodyBytes + 1}
+	req = httptest.NewRequest(http.MethodPut, defaultBasePath+"signed/Tom", big)
+	pool.auth.sign(req, "http://localhost:8002", nil)
+	w = httptest.NewRecorder()
+	pool.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge || big.n > defaultMaxBodyBytes+1 {
+		t.Fatalf("oversized body should return 413, got %d after %d bytes", w.Code, big.n)
+	}
+
+	// 统计信息同样需要认证，未知路径返回 404 而不是 panic
+	w = httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultStatsPath, nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("stats should require auth, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	NewHTTPPool("http://localhost:8001").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown path should return 404, got %d", w.Code)
+	}
+}
+
+// countingReader 产生 limit 个字节并记录被读取了多少
+type countingReader struct {
+	n, limit int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	if r.n >= r.limit {
+		return 0, io.EOF
+	}
+	if rest := r.limit - r.n; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	r.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestHTTPPeerKeys(t *testing.T) {
+	NewGroup("peer-keys", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	keys := map[string][]byte{
+		"http://localhost:8001": []byte("key1"),
+		"http://localhost:8002": []byte("key2"),
+	}
+	server := httptest.NewServer(NewHTTPPool("http://localhost:8001", WithPeerKeys(keys)))
+	defer server.Close()
+
+	getter := NewHTTPPool("http://localhost:8002", WithPeerKeys(keys)).newGetter(server.URL)
+	if err := getter.Get(&pb.Request{Group: "peer-keys", Key: "Tom"}, &pb.Response{}); err != nil {
+		t.Fatalf("get with peer key failed: %v", err)
+	}
+
+	// 冒充其他节点时，签名密钥与声明的节点不匹配
+	forged := NewHTTPPool("http://localhost:8003", WithPeerKeys(map[string][]byte{
+		"http://localhost:8003": []byte("key2"),
+	})).newGetter(server.URL)
+	if err := forged.Get(&pb.Request{Group: "peer-keys", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatal("unknown peer should be rejected")
+	}
+}
+
+func TestHTTPMutualTLS(t *testing.T) {
+	NewGroup("mtls", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	dir := t.TempDir()
+	certFile, keyFile, caFile := writeTestCerts(t, dir)
+	config, err := MutualTLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewHTTPPool("https://localhost:8001", WithTLS(config))
+	server := httptest.NewUnstartedServer(pool)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	getter := NewHTTPPool("https://localhost:8002", WithTLS(config)).newGetter(server.URL)
+	res := &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: "mtls", Key: "Tom"}, res); err != nil || string(res.Value) != "Tom" {
+		t.Fatalf("mTLS get failed: %q, %v", res.Value, err)
+	}
+
+	// 不出示客户端证书时握手失败
+	noCert := config.Clone()
+	noCert.Certificates = nil
+	if err := NewHTTPPool("https://localhost:8002", WithTLS(noCert)).newGetter(server.URL).
+		Get(&pb.Request{Group: "mtls", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatal("request without client certificate should fail")
+	}
+
+	// 未经 TLS 的请求返回 401
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultBasePath+"mtls/Tom", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("plain request should return 401, got %d", w.Code)
+	}
+}
+
+// writeTestCerts 生成一个自签名 CA 与由它签发的 127.0.0.1 证书，写入 dir 并返回文件路径
+func writeTestCerts(t *testing.T, dir string) (certFile, keyFile, caFile string) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "geecache test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "geecache node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, typ string, b []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	return write("node.pem", "CERTIFICATE", der), write("node-key.pem", "EC PRIVATE KEY", keyDER),
+		write("ca.pem", "CERTIFICATE", caDER)
+}
@@ -1,22 +1,36 @@
 package geecache
 
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"sync"
+)
+
 // ByteView 抽象一个 只读数据结构， 用来表示缓存值
 type ByteView struct {
 	b []byte	// b 用来存储真实值
+	compressed	bool	// b 是否为 flate 压缩后的数据，只有 cache 内部保存的值会被压缩
 }
 
-// Len 用来返回其所占的内存大小
+// Len 用来返回其所占的内存大小，压缩时为压缩后的大小
 func (v ByteView) Len() int {
 	return len(v.b)
 }
 
 // ByteSlice 用来返回一个拷贝， 防止缓存值被外部修改
 func (v ByteView) ByteSlice() []byte {
+	if v.compressed {
+		return v.uncompressed().b
+	}
 	return cloneBytes(v.b)
 }
 
 // String returns the data as a string, making a copy if necessary.
 func (v ByteView) String() string {
+	if v.compressed {
+		return string(v.uncompressed().b)
+	}
 	return string(v.b)
 }
 
@@ -25,3 +39,49 @@ func cloneBytes(b []byte) []byte {
 	copy(newB, b)
 	return newB
 }
+
+// flateWriters 按压缩级别复用 flate.Writer，创建 flate.Writer 需要分配较大的内存
+var flateWriters [flate.BestCompression - flate.HuffmanOnly + 1]sync.Pool
+
+// compress 返回按 level 压缩后的 ByteView，压缩后没有变小时返回 false
+func (v ByteView) compress(level int) (ByteView, bool) {
+	if v.compressed || level < flate.HuffmanOnly || level > flate.BestCompression {
+		return v, false
+	}
+	var buf bytes.Buffer
+	pool := &flateWriters[level-flate.HuffmanOnly]
+	w, _ := pool.Get().(*flate.Writer)
+	if w == nil {
+		w, _ = flate.NewWriter(&buf, level)
+	} else {
+		w.Reset(&buf)
+	}
+	w.Write(v.b)
+	w.Close()
+	w.Reset(ioutil.Discard)	// 放回前不再引用 buf
+	pool.Put(w)
+	if buf.Len() >= len(v.b) {
+		return v, false
+	}
+	return ByteView{b: buf.Bytes(), compressed: true}, true
+}
+
+// decompress 返回解压后的 ByteView
+func (v ByteView) decompress() (ByteView, error) {
+	if !v.compressed {
+		return v, nil
+	}
+	r := flate.NewReader(bytes.NewReader(v.b))
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ByteView{}, err
+	}
+	return ByteView{b: b}, nil
+}
+
+// uncompressed 解压数据，压缩的数据只由 compress 产生，因此不会解压失败
+func (v ByteView) uncompressed() ByteView {
+	dv, _ := v.decompress()
+	return dv
+}
@@ -1,35 +1,301 @@
 package geecache
 
 import (
+	"geecache/arc"
+	"geecache/lfu"
 	"geecache/lru"
+	"geecache/twoq"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// cache 用来实例化 lru
+// EvictionPolicy 是 cache 底层淘汰策略需要实现的接口，
+// lru、lfu、arc、twoq 包中的 Cache 均实现了该接口。
+type EvictionPolicy interface {
+	Get(key string) (val lru.Value, ok bool)
+	Add(key string, value lru.Value)
+	AddWithExpire(key string, value lru.Value, expire time.Time)
+	Remove(key string) bool
+	RemoveExpired() int
+	// Walk 从最先被淘汰的元素开始遍历，按遍历顺序重新加入可以尽量还原淘汰顺序
+	Walk(fn func(key string, value lru.Value, expire time.Time))
+	// SetMaxBytes 在运行时修改最大内存，缩小时立即淘汰多出的元素
+	SetMaxBytes(maxBytes int64)
+	Bytes() int64
+	Len() int
+}
+
+// PolicyFactory 按最大内存和淘汰回调创建一个 EvictionPolicy
+type PolicyFactory func(maxBytes int64, onEvicted func(key string, value lru.Value)) EvictionPolicy
+
+// 内置的淘汰策略
+var (
+	LRUPolicy PolicyFactory = func(maxBytes int64, onEvicted func(key string, value lru.Value)) EvictionPolicy {
+		return lru.New(maxBytes, onEvicted)
+	}
+	LFUPolicy PolicyFactory = func(maxBytes int64, onEvicted func(key string, value lru.Value)) EvictionPolicy {
+		return lfu.New(maxBytes, onEvicted)
+	}
+	ARCPolicy PolicyFactory = func(maxBytes int64, onEvicted func(key string, value lru.Value)) EvictionPolicy {
+		return arc.New(maxBytes, onEvicted)
+	}
+	// TwoQueuePolicy 可以抵抗一次性的大范围扫描
+	TwoQueuePolicy PolicyFactory = func(maxBytes int64, onEvicted func(key string, value lru.Value)) EvictionPolicy {
+		return twoq.New(maxBytes, onEvicted)
+	}
+)
+
+// cache 用来实例化淘汰策略，并发安全。
+// 淘汰策略的 Get 也会修改内部的链表，因此每次访问都需要加互斥锁。为了避免所有请求争抢同一把锁，
+// cache 可以按 key 的哈希分成多个 shard，每个 shard 有独立的锁和 cacheBytes/shards 的容量。
 type cache struct {
-	mu 			sync.Mutex
-	lru			*lru.Cache
-	cacheBytes int64
+	once		sync.Once
+	shards		[]*cacheShard
+	nshards		int			// shard 的个数，<= 1 时不分片
+	newPolicy	PolicyFactory	// 为 nil 时使用 LRUPolicy
+	cacheBytes int64			// 总容量，创建后通过 bytes 与 setCacheBytes 原子地读写
+	compress	bool		// 是否压缩保存的值
+	compressLevel	int		// flate 压缩级别
+	overhead	int			// 每个元素除 key 与值以外额外占用的内存，计入 cacheBytes
+	onEvict		func(key string, value ByteView)	// 值因容量不足被淘汰时调用，可以为 nil
+	onExpire	func(key string, value ByteView)	// 值过期被删除时调用，可以为 nil
+	nget		AtomicInt	// 以下为统计信息
+	nhit		AtomicInt
+	nevict		AtomicInt
+	nexpire		AtomicInt
+}
+
+// cacheShard 是 cache 的一个分片
+type cacheShard struct {
+	mu	sync.Mutex
+	lru	EvictionPolicy	// 默认为 lru.Cache
+	removing	bool		// 正在主动删除，此时淘汰策略的回调不属于淘汰事件
+	events		[]cacheEvent	// 持有锁期间产生的事件，释放锁后再回调，避免回调中访问 cache 造成死锁
+}
+
+// cacheEvent 是一次淘汰或过期
+type cacheEvent struct {
+	key		string
+	value	ByteView
+	expired	bool
+}
+
+// minCompressSize 小于该长度的值压缩后通常不会变小，直接保存
+const minCompressSize = 64
+
+// sizedView 是 cache 中实际保存的值，在 ByteView 的基础上计入每个元素的额外开销
+type sizedView struct {
+	ByteView
+	overhead  int
+	expire    time.Time // 用于在淘汰回调中区分过期与淘汰
+	refreshAt time.Time // 软过期时间，之后的访问仍返回该值但需要在后台刷新，零值表示不需要刷新
+}
+
+func (v sizedView) Len() int {
+	return v.ByteView.Len() + v.overhead
+}
+
+// init 在第一次使用时创建所有 shard
+func (c *cache) init() {
+	n := c.nshards
+	if n < 1 {
+		n = 1
+	}
+	newPolicy := c.newPolicy
+	if newPolicy == nil {
+		newPolicy = LRUPolicy
+	}
+	c.shards = make([]*cacheShard, n)
+	for i := range c.shards {
+		shard := &cacheShard{}
+		shard.lru = newPolicy(shardBytes(c.bytes(), n), func(key string, value lru.Value) {
+			if shard.removing {
+				return
+			}
+			v := value.(sizedView)
+			expired := !v.expire.IsZero() && !time.Now().Before(v.expire)
+			if expired {
+				c.nexpire.Add(1)
+			} else {
+				c.nevict.Add(1)
+			}
+			if (expired && c.onExpire != nil) || (!expired && c.onEvict != nil) {
+				shard.events = append(shard.events, cacheEvent{key: key, value: v.ByteView, expired: expired})
+			}
+		})
+		c.shards[i] = shard
+	}
+}
+
+// unlock 释放 shard 的锁，然后回调持有锁期间产生的事件
+func (c *cache) unlock(shard *cacheShard) {
+	events := shard.events
+	shard.events = nil
+	shard.mu.Unlock()
+	for _, e := range events {
+		if e.expired {
+			c.onExpire(e.key, e.value.uncompressed())
+		} else {
+			c.onEvict(e.key, e.value.uncompressed())
+		}
+	}
+}
+
+// shard 按 key 的 FNV-1a 哈希选择 shard
+func (c *cache) shard(key string) *cacheShard {
+	c.once.Do(c.init)
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return c.shards[h%uint32(len(c.shards))]
 }
 
-func (c *cache) add(key string, val ByteView) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+// CacheStats 是某个 cache 的统计信息
+type CacheStats struct {
+	Bytes     int64 `json:"bytes"`
+	Items     int64 `json:"items"`
+	Gets      int64 `json:"gets"`
+	Hits      int64 `json:"hits"`
+	Evictions   int64 `json:"evictions"`
+	Expirations int64 `json:"expirations"`
+}
+
+func (c *cache) stats() CacheStats {
+	s := CacheStats{
+		Gets:      c.nget.Get(),
+		Hits:      c.nhit.Get(),
+		Evictions:   c.nevict.Get(),
+		Expirations: c.nexpire.Get(),
+	}
+	c.once.Do(c.init)
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		s.Bytes += shard.lru.Bytes()
+		s.Items += int64(shard.lru.Len())
+		shard.mu.Unlock()
+	}
+	return s
+}
+
+// add 添加缓存值，expire 为零值时表示永不过期
+func (c *cache) add(key string, val ByteView, expire time.Time) {
+	c.addWithRefresh(key, val, expire, time.Time{})
+}
+
+// addWithRefresh 与 add 相同，refreshAt 为值的软过期时间
+func (c *cache) addWithRefresh(key string, val ByteView, expire, refreshAt time.Time) {
+	if c.compress && val.Len() >= minCompressSize {
+		if cv, ok := val.compress(c.compressLevel); ok {
+			val = cv
+		}
 	}
-	c.lru.Add(key, val)
+	shard := c.shard(key)
+	shard.mu.Lock()
+	shard.lru.AddWithExpire(key, sizedView{ByteView: val, overhead: c.overhead, expire: expire, refreshAt: refreshAt}, expire)
+	c.unlock(shard)
 }
 
 func (c *cache) get(key string) (val ByteView, ok bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
+	val, _, ok = c.getStale(key)
+	return
+}
+
+// getStale 与 get 相同，stale 表示值已经过了软过期时间
+func (c *cache) getStale(key string) (val ByteView, stale bool, ok bool) {
+	c.nget.Add(1)
+	shard := c.shard(key)
+	shard.mu.Lock()
+	v, ok := shard.lru.Get(key)
+	c.unlock(shard)
+	if !ok {
 		return
 	}
-	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), ok
+	c.nhit.Add(1)
+	sv := v.(sizedView)
+	stale = !sv.refreshAt.IsZero() && !time.Now().Before(sv.refreshAt)
+	// 在锁外解压，避免阻塞同一个 shard 上的其他请求
+	return sv.uncompressed(), stale, true
+}
+
+func (c *cache) remove(key string) {
+	shard := c.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.removing = true
+	shard.lru.Remove(key)
+	shard.removing = false
+}
+
+// setCacheBytes 修改 cache 的总容量，每个 shard 的容量仍为总容量的 1/n，被淘汰的值会触发 onEvict
+func (c *cache) setCacheBytes(cacheBytes int64) {
+	c.once.Do(c.init)
+	atomic.StoreInt64(&c.cacheBytes, cacheBytes)
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		shard.lru.SetMaxBytes(shardBytes(cacheBytes, len(c.shards)))
+		c.unlock(shard)
+	}
+}
+
+// bytes 返回 cache 当前的总容量
+func (c *cache) bytes() int64 {
+	return atomic.LoadInt64(&c.cacheBytes)
+}
+
+// shardBytes 返回总容量为 cacheBytes 时每个 shard 的容量。
+// 总容量小于 shard 个数时至少为 1，否则整除得到的 0 会使 shard 不受容量限制
+func shardBytes(cacheBytes int64, n int) int64 {
+	if cacheBytes <= 0 {
+		return 0
+	}
+	if per := cacheBytes / int64(n); per > 0 {
+		return per
 	}
-	return
+	return 1
 }
 
+// removeExpired 清理所有已过期的缓存值
+func (c *cache) removeExpired() int {
+	c.once.Do(c.init)
+	removed := 0
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		removed += shard.lru.RemoveExpired()
+		c.unlock(shard)
+	}
+	return removed
+}
+
+// cacheEntry 是 cache 中一个元素的副本，用于快照
+type cacheEntry struct {
+	key    string
+	value  ByteView
+	expire time.Time
+}
+
+// entries 返回所有未过期元素的副本，ByteView 只读，因此无需拷贝值。
+// 每个 shard 内按淘汰顺序排列，shard 个数不变时按顺序重新加入可以还原每个 shard 的淘汰顺序
+func (c *cache) entries() []cacheEntry {
+	c.once.Do(c.init)
+	now := time.Now()
+	var entries []cacheEntry
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		shard.lru.Walk(func(key string, value lru.Value, expire time.Time) {
+			if expire.IsZero() || now.Before(expire) {
+				entries = append(entries, cacheEntry{key: key, value: value.(sizedView).ByteView, expire: expire})
+			}
+		})
+		shard.mu.Unlock()
+	}
+	for i := range entries {
+		entries[i].value = entries[i].value.uncompressed()
+	}
+	return entries
+}
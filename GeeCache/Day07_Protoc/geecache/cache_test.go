@@ -0,0 +1,113 @@
+package geecache
+
+import (
+	"compress/flate"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShardedCache(t *testing.T) {
+	c := &cache{cacheBytes: 1 << 20, nshards: 8}
+	for i := 0; i < 1000; i++ {
+		c.add(fmt.Sprintf("key%d", i), ByteView{b: []byte("value")}, time.Time{})
+	}
+	if stats := c.stats(); stats.Items != 1000 {
+		t.Fatalf("expect 1000 items, got %d", stats.Items)
+	}
+
+	used := 0
+	for _, shard := range c.shards {
+		if shard.lru.Len() > 0 {
+			used++
+		}
+	}
+	if used != 8 {
+		t.Fatalf("keys should spread over all shards, used %d", used)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if v, ok := c.get(fmt.Sprintf("key%d", i)); !ok || v.String() != "value" {
+			t.Fatalf("key%d missed", i)
+		}
+	}
+	c.remove("key1")
+	if _, ok := c.get("key1"); ok {
+		t.Fatal("key1 should be removed")
+	}
+	if n := len(c.entries()); n != 999 {
+		t.Fatalf("expect 999 entries, got %d", n)
+	}
+
+	// 总容量小于 shard 个数时每个 shard 仍受容量限制，而不是变为不限制
+	c.setCacheBytes(4)
+	if n := c.stats().Items; n != 0 || c.bytes() != 4 {
+		t.Fatalf("tiny capacity should evict everything, got %d items, %d bytes", n, c.bytes())
+	}
+	small := &cache{cacheBytes: 4, nshards: 8}
+	for i := 0; i < 100; i++ {
+		small.add(fmt.Sprintf("key%d", i), ByteView{b: []byte("value")}, time.Time{})
+	}
+	if n := small.stats().Items; n != 0 {
+		t.Fatalf("tiny capacity should not be unlimited, got %d items", n)
+	}
+}
+
+// BenchmarkCacheGetParallel 比较不分片与分片的 cache 在并发读取时的性能，
+// 可以用 go test -bench CacheGetParallel -cpu 1,8,32 观察核数增加时的差异
+func BenchmarkCacheGetParallel(b *testing.B) {
+	const keys = 1 << 12
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = fmt.Sprintf("key%d", i)
+	}
+	for _, shards := range []int{1, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			c := &cache{cacheBytes: 0, nshards: shards}
+			for _, key := range names {
+				c.add(key, ByteView{b: []byte("value")}, time.Time{})
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.get(names[i&(keys-1)])
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestCacheCompression(t *testing.T) {
+	raw := []byte(strings.Repeat(`{"name":"Tom","score":630},`, 40))
+	c := &cache{compress: true, compressLevel: flate.DefaultCompression}
+	c.add("json", ByteView{b: raw}, time.Time{})
+	c.add("small", ByteView{b: []byte("630")}, time.Time{})
+
+	if stats := c.stats(); stats.Bytes >= int64(len(raw)) {
+		t.Fatalf("compressed size %d should be smaller than %d", stats.Bytes, len(raw))
+	}
+	if v, ok := c.get("json"); !ok || v.compressed || v.String() != string(raw) {
+		t.Fatal("get should return the uncompressed value")
+	}
+	if v, ok := c.get("small"); !ok || v.String() != "630" {
+		t.Fatal("small values are stored as is")
+	}
+	if entries := c.entries(); len(entries) != 2 || entries[0].value.compressed {
+		t.Fatal("entries should be uncompressed for snapshots")
+	}
+}
+
+func TestCacheEntryOverhead(t *testing.T) {
+	const overhead = 100
+	size := int64(len("k1") + len("v1") + overhead)
+	c := &cache{cacheBytes: 2 * size, overhead: overhead}
+	for _, key := range []string{"k1", "k2", "k3"} {
+		c.add(key, ByteView{b: []byte("v" + key[1:])}, time.Time{})
+	}
+	if stats := c.stats(); stats.Items != 2 || stats.Bytes != 2*size || stats.Evictions != 1 {
+		t.Fatalf("overhead should count towards cacheBytes, stats: %+v", stats)
+	}
+}
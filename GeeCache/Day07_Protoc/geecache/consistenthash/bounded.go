@@ -0,0 +1,141 @@
+package consistenthash
+
+import (
+	"math"
+	"sync"
+)
+
+// Bounded 实现了带负载上限的一致性哈希 (Consistent Hashing with Bounded Loads)。
+// 每个节点的负载不能超过平均负载的 (1+epsilon) 倍，key 所属节点已满时沿着哈希环顺时针选择下一个未满的节点。
+// 负载由调用方通过 Inc/Done 维护，例如正在处理的请求数或已分配的 key 数。
+//
+// 负载只是本节点观察到的值，不同节点对同一个 key 可能选出不同的节点，因此 Bounded 只适用于 read-through 的读取：
+// 任一节点都可以从数据源加载 key。写入与删除需要通过 Unbounded 使用不考虑负载的哈希环，HTTPPool 的 PickOwner 即是如此。
+type Bounded struct {
+	*Map
+	epsilon	float64
+	mu		sync.Mutex
+	loads	map[string]int64	// 每个节点当前的负载
+	total	int64				// 所有节点负载之和
+}
+
+// NewBounded create a Bounded instance
+func NewBounded(replicas int, epsilon float64, fn Hash) *Bounded {
+	return &Bounded{
+		Map:     New(replicas, fn),
+		epsilon: epsilon,
+		loads:   make(map[string]int64),
+	}
+}
+
+// Add 添加节点，重复添加已存在的节点会被忽略
+func (b *Bounded) Add(nodes ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, node := range nodes {
+		if _, ok := b.loads[node]; ok {
+			continue
+		}
+		b.loads[node] = 0
+		b.Map.Add(node)
+	}
+}
+
+// Remove 删除节点及其负载
+func (b *Bounded) Remove(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if load, ok := b.loads[node]; ok {
+		b.total -= load
+		delete(b.loads, node)
+		b.Map.Remove(node)
+	}
+}
+
+// Get 返回 key 对应的、负载未超过上限的第一个节点
+func (b *Bounded) Get(key string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	limit := b.maxLoad()
+	var picked string
+	b.Map.Walk(key, func(node string) bool {
+		if b.loads[node]+1 <= limit {
+			picked = node
+			return false
+		}
+		return true
+	})
+	if picked == "" {
+		// 所有节点都已满，退化为普通的一致性哈希
+		picked = b.Map.Get(key)
+	}
+	return picked
+}
+
+// Walk 先按哈希环顺序遍历未超过负载上限的节点，再遍历已满的节点
+func (b *Bounded) Walk(key string, fn func(node string) bool) {
+	b.mu.Lock()
+	limit := b.maxLoad()
+	var full []string
+	var available []string
+	b.Map.Walk(key, func(node string) bool {
+		if b.loads[node]+1 > limit {
+			full = append(full, node)
+		} else {
+			available = append(available, node)
+		}
+		return true
+	})
+	b.mu.Unlock()
+
+	for _, node := range append(available, full...) {
+		if !fn(node) {
+			return
+		}
+	}
+}
+
+// Unbounded 返回不考虑负载的哈希环，与 Add、Remove 并发调用时需由调用方加锁
+func (b *Bounded) Unbounded() Picker {
+	return b.Map
+}
+
+// Inc 增加节点的负载
+func (b *Bounded) Inc(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.loads[node]; ok {
+		b.loads[node]++
+		b.total++
+	}
+}
+
+// Done 减少节点的负载
+func (b *Bounded) Done(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if load, ok := b.loads[node]; ok && load > 0 {
+		b.loads[node]--
+		b.total--
+	}
+}
+
+// Loads 返回各节点当前的负载
+func (b *Bounded) Loads() map[string]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	loads := make(map[string]int64, len(b.loads))
+	for node, load := range b.loads {
+		loads[node] = load
+	}
+	return loads
+}
+
+// maxLoad 计算再加入一个负载后每个节点允许的最大负载，调用时需持有 b.mu
+func (b *Bounded) maxLoad() int64 {
+	if len(b.loads) == 0 {
+		return 0
+	}
+	avg := float64(b.total+1) / float64(len(b.loads))
+	return int64(math.Ceil(avg * (1 + b.epsilon)))
+}
@@ -46,3 +46,45 @@ func TestHashing(t *testing.T)  {
 	fmt.Println("-----------------------")
 	fmt.Println(consisHash.Show())
 }
+
+func TestRemoveUnknown(t *testing.T) {
+	consisHash := New(3, nil)
+	consisHash.Add("a", "b")
+	keys := len(consisHash.keys)
+
+	consisHash.Remove("c")
+	if len(consisHash.keys) != keys {
+		t.Fatalf("removing unknown node should not change the ring, got %d keys", len(consisHash.keys))
+	}
+	consisHash.Remove("a")
+	consisHash.Remove("a")
+	if len(consisHash.keys) != 3 || consisHash.Get("anything") != "b" {
+		t.Fatalf("only node b should remain, got %d keys", len(consisHash.keys))
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		atoi, _ := strconv.Atoi(string(key))
+		return uint32(atoi)
+	})
+	// 虚拟节点：2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	testCases := map[string][]string{
+		"11": {"2", "4"},
+		"23": {"4", "6"},
+		"27": {"2", "4"},
+	}
+	for k, v := range testCases {
+		if got := GetN(hash, k, 2); fmt.Sprint(got) != fmt.Sprint(v) {
+			t.Errorf("GetN(%s, 2) = %v, should be %v", k, got, v)
+		}
+	}
+	if got := GetN(hash, "11", 5); len(got) != 3 {
+		t.Errorf("GetN should return at most all nodes, got %v", got)
+	}
+	if got := GetN(hash, "11", 1); len(got) != 1 || got[0] != hash.Get("11") {
+		t.Errorf("GetN(key, 1) should equal Get, got %v", got)
+	}
+}
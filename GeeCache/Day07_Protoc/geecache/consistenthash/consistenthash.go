@@ -61,11 +61,38 @@ func (m *Map) Get(key string) string {
 	return m.hashMap[m.keys[searchIdx%len(m.keys)]]// 映射真实节点
 }
 
+// Walk 从 key 所在的位置开始顺时针遍历哈希环上的真实节点，每个真实节点只访问一次，fn 返回 false 时停止。
+// 可用于在 key 所属节点不可用时选择下一个节点。
+func (m *Map) Walk(key string, fn func(node string) bool) {
+	if len(m.keys) == 0 {
+		return
+	}
+	hash := int(m.hash([]byte(key)))
+	searchIdx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	seen := make(map[string]bool)
+	for i := 0; i < len(m.keys); i++ {
+		node := m.hashMap[m.keys[(searchIdx+i)%len(m.keys)]]
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		if !fn(node) {
+			return
+		}
+	}
+}
+
 // Remove 删除只需要删除掉节点对应的虚拟节点和映射关系，至于均摊给其他节点，那是删除之后自然会发生的
 func (m *Map) Remove(key string) {
 	for i := 0; i < m.replicas; i++ {
 		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
 		idx := sort.SearchInts(m.keys, hash)
+		// 节点不存在或虚拟节点已被删除时跳过，避免误删其他虚拟节点
+		if idx >= len(m.keys) || m.keys[idx] != hash || m.hashMap[hash] != key {
+			continue
+		}
 		// 此处表示 slice 切片内部的元素被打散传入
 		m.keys = append(m.keys[:idx], m.keys[idx+1:]...)
 		delete(m.hashMap, hash)
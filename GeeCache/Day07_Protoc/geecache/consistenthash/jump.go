@@ -0,0 +1,108 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"strconv"
+	"sync"
+)
+
+// Jump 实现了 Jump Consistent Hash，不需要虚拟节点，内存占用小且分布均匀。
+// 它只能高效地增删最后一个桶：删除中间的节点时，用最后一个节点填补空位，
+// 因此被删除节点与最后一个节点上的 key 都会迁移。
+type Jump struct {
+	hash	Hash
+	mu		sync.RWMutex
+	nodes	[]string		// 桶编号 -> 节点
+	index	map[string]int	// 节点 -> 桶编号
+}
+
+// NewJump create a Jump instance
+func NewJump(fn Hash) *Jump {
+	j := &Jump{
+		hash:  fn,
+		index: make(map[string]int),
+	}
+	if j.hash == nil {
+		j.hash = crc32.ChecksumIEEE
+	}
+	return j
+}
+
+// Add 添加节点，新节点作为最后一个桶
+func (j *Jump) Add(nodes ...string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, node := range nodes {
+		if _, ok := j.index[node]; ok {
+			continue
+		}
+		j.index[node] = len(j.nodes)
+		j.nodes = append(j.nodes, node)
+	}
+}
+
+// Remove 删除节点，并将最后一个节点移动到被删除节点的桶中
+func (j *Jump) Remove(node string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	idx, ok := j.index[node]
+	if !ok {
+		return
+	}
+	last := len(j.nodes) - 1
+	j.nodes[idx] = j.nodes[last]
+	j.index[j.nodes[idx]] = idx
+	j.nodes = j.nodes[:last]
+	delete(j.index, node)
+}
+
+// Get 返回 key 对应的节点
+func (j *Jump) Get(key string) string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[jumpHash(mix64(uint64(j.hash([]byte(key)))), len(j.nodes))]
+}
+
+// Walk 依次对 key 加上序号重新哈希得到后续节点，最后按桶顺序补全剩余节点
+func (j *Jump) Walk(key string, fn func(node string) bool) {
+	j.mu.RLock()
+	nodes := make([]string, 0, len(j.nodes))
+	seen := make(map[int]bool, len(j.nodes))
+	for i := 0; i < len(j.nodes) && len(seen) < len(j.nodes); i++ {
+		k := key
+		if i > 0 {
+			k = strconv.Itoa(i) + key
+		}
+		idx := int(jumpHash(mix64(uint64(j.hash([]byte(k)))), len(j.nodes)))
+		if !seen[idx] {
+			seen[idx] = true
+			nodes = append(nodes, j.nodes[idx])
+		}
+	}
+	for idx, node := range j.nodes {
+		if !seen[idx] {
+			nodes = append(nodes, node)
+		}
+	}
+	j.mu.RUnlock()
+
+	for _, node := range nodes {
+		if !fn(node) {
+			return
+		}
+	}
+}
+
+// jumpHash 即论文中的 JumpConsistentHash(key, num_buckets)
+func jumpHash(key uint64, buckets int) int32 {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int32(b)
+}
@@ -0,0 +1,49 @@
+package consistenthash
+
+// Picker 是根据 key 选择节点的策略，Map、Bounded、Jump 与 Rendezvous 均实现了该接口，
+// HTTPPool 可以通过 WithPicker 选择其中之一。
+type Picker interface {
+	Add(nodes ...string)
+	Remove(node string)
+	Get(key string) string
+	// Walk 按该策略的优先顺序遍历所有真实节点，每个节点只访问一次，fn 返回 false 时停止
+	Walk(key string, fn func(node string) bool)
+}
+
+// Unbounded 由选择结果依赖本地状态的 Picker 实现，例如按本节点观察到的负载选择节点的 Bounded。
+// 不同节点对同一个 key 可能选出不同的节点，写入与删除等需要所有节点一致的操作应使用 Unbounded 返回的、
+// 只由节点列表决定的 Picker
+type Unbounded interface {
+	Unbounded() Picker
+}
+
+var (
+	_ Picker = (*Map)(nil)
+	_ Picker = (*Bounded)(nil)
+	_ Picker = (*Jump)(nil)
+	_ Picker = (*Rendezvous)(nil)
+)
+
+// GetN 按 p 的优先顺序返回 key 的前 n 个不同的真实节点，第一个即 Get 返回的节点。
+// 真实节点不足 n 个时返回所有节点，用于将 key 复制到多个节点上
+func GetN(p Picker, key string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	nodes := make([]string, 0, n)
+	p.Walk(key, func(node string) bool {
+		nodes = append(nodes, node)
+		return len(nodes) < n
+	})
+	return nodes
+}
+
+// mix64 是 splitmix64 的最后一步，用于打散 32 位哈希值组合后的结果
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
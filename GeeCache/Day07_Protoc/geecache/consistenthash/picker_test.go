@@ -0,0 +1,134 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+const (
+	testNodes = 10
+	testKeys  = 100000
+)
+
+func testNodeNames() []string {
+	nodes := make([]string, testNodes)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("http://10.0.0.%d:8001", i)
+	}
+	return nodes
+}
+
+func newTestPickers() map[string]Picker {
+	return map[string]Picker{
+		"ring":       New(50, nil),
+		"bounded":    NewBounded(50, 0.25, nil),
+		"jump":       NewJump(nil),
+		"rendezvous": NewRendezvous(nil),
+	}
+}
+
+// assign 计算每个 key 所属的节点，对于 Bounded 以已分配的 key 数作为负载
+func assign(p Picker) map[string]string {
+	owners := make(map[string]string, testKeys)
+	for i := 0; i < testKeys; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		node := p.Get(key)
+		if b, ok := p.(*Bounded); ok {
+			b.Inc(node)
+		}
+		owners[key] = node
+	}
+	return owners
+}
+
+func TestDistribution(t *testing.T) {
+	maxRatio := map[string]float64{
+		"ring":       2.0,
+		"bounded":    1.25 + 0.01,
+		"jump":       1.1,
+		"rendezvous": 1.1,
+	}
+	for name, p := range newTestPickers() {
+		p.Add(testNodeNames()...)
+		counts := make(map[string]int)
+		for _, node := range assign(p) {
+			counts[node]++
+		}
+		max := 0
+		for _, c := range counts {
+			if c > max {
+				max = c
+			}
+		}
+		ratio := float64(max) / (float64(testKeys) / testNodes)
+		t.Logf("%-10s nodes: %d, max/avg load: %.3f", name, len(counts), ratio)
+		if len(counts) != testNodes || ratio > maxRatio[name] {
+			t.Errorf("%s: uneven distribution, max/avg load %.3f", name, ratio)
+		}
+	}
+}
+
+func TestRemoveMovement(t *testing.T) {
+	// 删除一个节点后最多允许迁移的 key 比例
+	maxMoved := map[string]float64{
+		"ring":       0.2,
+		"jump":       0.25,
+		"rendezvous": 0.12,
+	}
+	nodes := testNodeNames()
+	for name, p := range newTestPickers() {
+		if _, ok := maxMoved[name]; !ok {
+			continue
+		}
+		p.Add(nodes...)
+		before := assign(p)
+		removed := nodes[3]
+		p.Remove(removed)
+		after := assign(p)
+
+		moved := 0
+		for key, node := range before {
+			if after[key] == removed {
+				t.Fatalf("%s: key %s still maps to removed node", name, key)
+			}
+			if after[key] != node {
+				moved++
+				// 环与 rendezvous 只会迁移原本属于被删除节点的 key
+				if name != "jump" && node != removed {
+					t.Fatalf("%s: key %s moved from %s which was not removed", name, key, node)
+				}
+			}
+		}
+		ratio := float64(moved) / testKeys
+		t.Logf("%-10s moved keys after removing 1/%d nodes: %.3f", name, testNodes, ratio)
+		if ratio > maxMoved[name] {
+			t.Errorf("%s: too many keys moved: %.3f", name, ratio)
+		}
+	}
+}
+
+func TestBoundedOverflow(t *testing.T) {
+	b := NewBounded(3, 0, nil)
+	b.Add("a", "b")
+	owner := b.Get("key")
+	b.Inc(owner)
+	// 负载上限为平均负载，owner 已满时选择另一个节点
+	if next := b.Get("key"); next == owner {
+		t.Fatalf("key should overflow from %s", owner)
+	}
+	b.Done(owner)
+	if b.Get("key") != owner {
+		t.Fatal("key should go back to its owner after load drops")
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for name, p := range newTestPickers() {
+		p.Add(testNodeNames()...)
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				p.Get(fmt.Sprintf("key-%d", i))
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"sort"
+	"sync"
+)
+
+// Rendezvous 实现了最高随机权重哈希 (Highest Random Weight)：
+// 对每个节点计算 hash(node, key) 得分，得分最高的节点即为 key 所属节点。
+// 删除节点时只有属于该节点的 key 会迁移，且不需要虚拟节点，代价是每次 Get 为 O(节点数)。
+type Rendezvous struct {
+	hash	Hash
+	mu		sync.RWMutex
+	nodes	map[string]uint32	// 节点 -> 节点名的哈希值
+}
+
+// NewRendezvous create a Rendezvous instance
+func NewRendezvous(fn Hash) *Rendezvous {
+	r := &Rendezvous{
+		hash:  fn,
+		nodes: make(map[string]uint32),
+	}
+	if r.hash == nil {
+		r.hash = crc32.ChecksumIEEE
+	}
+	return r
+}
+
+// Add 添加节点
+func (r *Rendezvous) Add(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, node := range nodes {
+		r.nodes[node] = r.hash([]byte(node))
+	}
+}
+
+// Remove 删除节点
+func (r *Rendezvous) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.nodes, node)
+}
+
+// Get 返回得分最高的节点
+func (r *Rendezvous) Get(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keyHash := r.hash([]byte(key))
+	var (
+		picked string
+		best   uint64
+	)
+	for node, nodeHash := range r.nodes {
+		// 得分相同时按节点名决定，保证结果与 map 的遍历顺序无关
+		if s := score(nodeHash, keyHash); picked == "" || s > best || (s == best && node < picked) {
+			picked, best = node, s
+		}
+	}
+	return picked
+}
+
+// Walk 按得分从高到低遍历节点
+func (r *Rendezvous) Walk(key string, fn func(node string) bool) {
+	r.mu.RLock()
+	keyHash := r.hash([]byte(key))
+	nodes := make([]string, 0, len(r.nodes))
+	scores := make(map[string]uint64, len(r.nodes))
+	for node, nodeHash := range r.nodes {
+		nodes = append(nodes, node)
+		scores[node] = score(nodeHash, keyHash)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if scores[nodes[i]] != scores[nodes[j]] {
+			return scores[nodes[i]] > scores[nodes[j]]
+		}
+		return nodes[i] < nodes[j]
+	})
+	for _, node := range nodes {
+		if !fn(node) {
+			return
+		}
+	}
+}
+
+func score(nodeHash, keyHash uint32) uint64 {
+	return mix64(uint64(nodeHash)<<32 | uint64(keyHash))
+}
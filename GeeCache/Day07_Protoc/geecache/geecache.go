@@ -1,10 +1,16 @@
 package geecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	pb "geecache/geecachepb"
 	"geecache/singleflight"
 	"log"
+	"math/rand"
+	"sort"
 	"sync"
+	"time"
 )
 
 type Getter interface {
@@ -24,23 +30,231 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// TTLGetter 是一个可选接口，Getter 实现它之后可以为每个 key 单独指定过期时间。
+// 返回的 ttl <= 0 时使用 Group 的默认过期时间。
+type TTLGetter interface {
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+// TTLGetterFunc 与 GetterFunc 类似，是 TTLGetter 的接口型函数
+type TTLGetterFunc func(key string) ([]byte, time.Duration, error)
+
+func (f TTLGetterFunc) Get(key string) ([]byte, error) {
+	bytes, _, err := f(key)
+	return bytes, err
+}
+
+func (f TTLGetterFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
+
+// ContextGetter 是一个可选接口，Getter 实现它之后加载数据时会收到 context，
+// 在 Group 的加载超时到达时可以及时放弃，而不是一直阻塞。
+type ContextGetter interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+// ContextGetterFunc 与 GetterFunc 类似，是 ContextGetter 的接口型函数
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f ContextGetterFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// ContextTTLGetter 同时具有 ContextGetter 与 TTLGetter 的能力：加载时收到 context，并为每个 key 指定过期时间。
+// Getter 同时实现了 ContextGetter 与 TTLGetter 但没有实现该接口时，Group 调用 GetWithTTL 以保留过期时间
+type ContextTTLGetter interface {
+	GetWithTTLContext(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+
+// ContextTTLGetterFunc 与 GetterFunc 类似，是 ContextTTLGetter 的接口型函数
+type ContextTTLGetterFunc func(ctx context.Context, key string) ([]byte, time.Duration, error)
+
+func (f ContextTTLGetterFunc) Get(key string) ([]byte, error) {
+	bytes, _, err := f(context.Background(), key)
+	return bytes, err
+}
+
+func (f ContextTTLGetterFunc) GetWithTTLContext(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	return f(ctx, key)
+}
+
+// NotFoundError 表示数据源中不存在 key。Getter 返回该错误时，Group 会将这次未命中
+// 按 negativeTTL 缓存起来，过期前对该 key 的请求不会再访问数据源。
+type NotFoundError struct {
+	Key string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s not exist", e.Key)
+}
+
+// IsNotFound 判断 err 是否为 NotFoundError
+func IsNotFound(err error) bool {
+	var nf *NotFoundError
+	return errors.As(err, &nf)
+}
+
+// Setter 是一个可选接口，Getter 实现它之后，Group.Set 会在 key 所属节点上同时更新数据源。
+type Setter interface {
+	Set(key string, value []byte) error
+}
+
+// WriteMode 决定 Group.Set 如何更新数据源
+type WriteMode int
+
+const (
+	// WriteThrough 先同步写入数据源，成功后再更新缓存
+	WriteThrough WriteMode = iota
+	// WriteBehind 先更新缓存，再由后台协程异步写入数据源
+	WriteBehind
+)
+
+// pendingWrite 是等待异步写入数据源的值
+type pendingWrite struct {
+	key   string
+	value []byte
+}
 
 // Group 一个 Group 可以认为是一个缓存的命名空间
 type Group struct {
 	name		string
 	getter		Getter		// 缓存未命中时获取源数据的回调(callback)。
-	mainCache	cache
-	peers		PeerPicker	// 用于 group 中选取 peer
+	mainCache	cache		// 本节点作为 key 所属节点时缓存的值
+	// hotCache 缓存从远程节点获取的热点数据的副本，避免热点 key 每次都要经过一次网络请求。
+	// 只有按 hotSampleRate 采样命中的值才会放入，容量远小于 mainCache。
+	hotCache	cache
+	hotSampleRate	int		// 每 hotSampleRate 次远程获取中大约有一次会放入 hotCache，<= 0 表示关闭
+	missCache	cache		// 缓存 Getter 返回 NotFoundError 的 key，值为空
+	negativeTTL	time.Duration	// missCache 中未命中记录的过期时间，<= 0 表示不缓存未命中
+	peersMu		sync.RWMutex
+	peers		PeerPicker	// 用于 group 中选取 peer，可以通过 RegisterPeers 更换，读取时使用 peerPicker
 	loader 		*singleflight.Group	// 用来确保 key 只被 call 一次
+	ttl			time.Duration	// 缓存值的默认过期时间，0 表示永不过期
+	sweepInterval	time.Duration	// 后台清理过期缓存的间隔，<= 0 表示不启动清理协程
+	stop		chan struct{}	// 用于停止后台清理协程
+	writeMode	WriteMode	// getter 实现了 Setter 时，Set 更新数据源的方式
+	writes		chan pendingWrite	// WriteBehind 模式下等待写入数据源的队列
+	writesMu	sync.RWMutex	// 入队时持有读锁，writeBehind 关闭队列时持有写锁
+	writesClosed	bool		// 队列已关闭，之后的写入返回 errGroupDestroyed
+	writesDone	chan struct{}	// writeBehind 写完队列中剩余的值后关闭
+	loadTimeout	time.Duration	// 一次共享加载的超时时间，<= 0 表示不限制
+	hooks		Hooks		// 事件回调
+	softTTL		time.Duration	// 值加载后经过 softTTL 变为陈旧，访问时返回旧值并在后台刷新，<= 0 表示关闭
+	refreshMu	sync.Mutex
+	refreshing	map[string]bool	// 正在后台刷新的 key
+
+	Stats		Stats		// Group 的统计信息
 }
 
+// GroupOption 用于在 NewGroup 时对 Group 进行可选配置
+type GroupOption func(*Group)
+
+// WithTTL 设置缓存值的默认过期时间
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// WithSweepInterval 设置后台清理过期缓存的间隔，<= 0 表示只依赖访问时的惰性过期
+func WithSweepInterval(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.sweepInterval = interval
+	}
+}
+
+// WithHotCache 设置 hotCache 的最大内存和采样率，maxBytes 或 sampleRate <= 0 时关闭 hotCache
+func WithHotCache(maxBytes int64, sampleRate int) GroupOption {
+	return func(g *Group) {
+		g.hotCache.cacheBytes = maxBytes
+		g.hotSampleRate = sampleRate
+	}
+}
+
+// WithEvictionPolicy 设置 mainCache 与 hotCache 使用的淘汰策略，默认为 LRUPolicy
+func WithEvictionPolicy(newPolicy PolicyFactory) GroupOption {
+	return func(g *Group) {
+		g.mainCache.newPolicy = newPolicy
+		g.hotCache.newPolicy = newPolicy
+	}
+}
+
+// WithShards 将 mainCache、hotCache 与 missCache 各自分成 n 个独立加锁的 shard，减少并发访问时的锁竞争。
+// 每个 shard 的容量为总容量的 1/n，因此淘汰只在 shard 内进行。n <= 1 时不分片
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.mainCache.nshards = n
+		g.hotCache.nshards = n
+		g.missCache.nshards = n
+	}
+}
+
+// WithCompression 使用 flate 按 level 压缩 mainCache 与 hotCache 中保存的值，cacheBytes 按压缩后的大小计算。
+// 读取时透明解压，以 CPU 换取内存，适合 JSON 等压缩率高的值
+func WithCompression(level int) GroupOption {
+	return func(g *Group) {
+		g.mainCache.compress, g.mainCache.compressLevel = true, level
+		g.hotCache.compress, g.hotCache.compressLevel = true, level
+	}
+}
+
+// WithEntryOverhead 设置每个元素除 key 与值以外额外占用的内存（链表节点、map 项等），
+// 计入 cacheBytes，使 cacheBytes 更接近实际占用的内存。默认为 0
+func WithEntryOverhead(overhead int) GroupOption {
+	return func(g *Group) {
+		g.mainCache.overhead = overhead
+		g.hotCache.overhead = overhead
+		g.missCache.overhead = overhead
+	}
+}
+
+// WithWriteMode 设置 Set 更新数据源的方式，queueSize 为 WriteBehind 模式下异步写入队列的长度
+func WithWriteMode(mode WriteMode, queueSize int) GroupOption {
+	return func(g *Group) {
+		g.writeMode = mode
+		if mode == WriteBehind {
+			g.writes = make(chan pendingWrite, queueSize)
+		}
+	}
+}
+
+// WithNegativeTTL 设置未命中记录的过期时间，<= 0 表示不缓存 Getter 返回的 NotFoundError
+func WithNegativeTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negativeTTL = ttl
+	}
+}
+
+// WithLoadTimeout 设置从远程节点或 Getter 加载一个 key 的超时时间。
+// 加载由同一个 key 的所有调用者共享，因此不受某个调用者 ctx 取消的影响，只受该超时限制。
+func WithLoadTimeout(timeout time.Duration) GroupOption {
+	return func(g *Group) {
+		g.loadTimeout = timeout
+	}
+}
+
+const (
+	defaultSweepInterval = time.Minute
+	defaultHotCacheRatio = 8	// 默认 hotCache 大小为 mainCache 的 1/8
+	defaultHotSampleRate = 10
+	defaultNegativeTTL   = 10 * time.Second
+	defaultMissCacheRatio = 16	// 默认 missCache 大小为 mainCache 的 1/16
+)
+
 var (
 	mu	sync.RWMutex
 	groups	= make(map[string]*Group)
 )
 
 // NewGroup create a new instance
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// 同名的 Group 已经存在时，新的 Group 会替换它，旧 Group 的后台协程被停止，与 DestroyGroup 相同
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
@@ -50,12 +264,49 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 		name:         name,
 		getter:       getter,
 		mainCache:    cache{cacheBytes: cacheBytes},
+		hotCache:     cache{cacheBytes: cacheBytes / defaultHotCacheRatio},
+		hotSampleRate: defaultHotSampleRate,
+		missCache:    cache{cacheBytes: cacheBytes / defaultMissCacheRatio},
+		negativeTTL:  defaultNegativeTTL,
 		loader: &singleflight.Group{},
+		sweepInterval: defaultSweepInterval,
+		stop:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.registerCacheHooks()
+	// 只有可能存在过期数据时才需要后台清理
+	if _, ok := getter.(TTLGetter); (ok || g.ttl > 0) && g.sweepInterval > 0 {
+		go g.sweep()
+	}
+	if _, ok := getter.(Setter); ok && g.writes != nil {
+		g.writesDone = make(chan struct{})
+		go g.writeBehind()
+	}
+	if old, ok := groups[name]; ok {
+		close(old.stop)
 	}
 	groups[name] = g
 	return g
 }
 
+// sweep 定期清理 mainCache 和 hotCache 中的过期数据，避免过期但不再被访问的值一直占用内存
+func (g *Group) sweep() {
+	ticker := time.NewTicker(g.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if n := g.mainCache.removeExpired() + g.hotCache.removeExpired() + g.missCache.removeExpired(); n > 0 {
+				log.Printf("[sweep] group %s removed %d expired keys", g.name, n)
+			}
+		case <-g.stop:
+			return
+		}
+	}
+}
+
 // GetGroup returns the named group previously created with NewGroup, or
 // nil if there's no such group.
 func GetGroup(name string) *Group {
@@ -65,67 +316,503 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// errGroupDestroyed 表示 WriteBehind 模式下 Group 已被销毁，写入无法再进入队列
+var errGroupDestroyed = errors.New("group destroyed")
+
+// DestroyGroup 从全局的 groups 中移除名为 name 的 Group，并停止它的后台清理与 WriteBehind 协程，
+// 队列中尚未写入数据源的值写入完成后才返回。返回该 Group 是否存在。
+// 销毁后 GetGroup 与节点间的请求都找不到该 Group，调用方也不应再使用它，缓存的值随 Group 一起被回收
+func DestroyGroup(name string) bool {
+	mu.Lock()
+	g, ok := groups[name]
+	delete(groups, name)
+	mu.Unlock()
+	if ok {
+		close(g.stop)
+		if g.writesDone != nil {
+			<-g.writesDone
+		}
+	}
+	return ok
+}
+
+// ListGroups 按名称顺序返回所有 Group 的名称
+func ListGroups() []string {
+	mu.RLock()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// SetCacheBytes 在运行时修改 mainCache 的容量，缩小时立即淘汰多出的值，0 表示不限制。
+// missCache 按与 NewGroup 相同的比例调整；hotCache 的容量由 WithHotCache 决定，保持不变
+func (g *Group) SetCacheBytes(cacheBytes int64) {
+	g.mainCache.setCacheBytes(cacheBytes)
+	g.missCache.setCacheBytes(cacheBytes / defaultMissCacheRatio)
+}
+
 // Get val for a key from cache
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与 Get 相同，但在 ctx 结束时放弃等待加载结果并返回 ctx.Err()，
+// 正在进行的共享加载不会被取消，其结果仍会写入缓存。
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	log.Println("[Get] start Cache Hit!")
+	g.Stats.Gets.Add(1)
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is empty")
 	}
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[Get] Cache Hit!")
-		return v, nil
+	if v, ok, err := g.lookupCache(key); ok {
+		return v, err
 	}
 	// 如果缓存没有，就进行加载
-	return g.load(key)
+	return g.load(ctx, key)
+}
+
+// lookupCache 依次查找 mainCache、hotCache 与 missCache，ok 为 false 时需要加载。
+// missCache 命中时 ok 为 true，err 为 NotFoundError
+func (g *Group) lookupCache(key string) (v ByteView, ok bool, err error) {
+	if v, stale, ok := g.mainCache.getStale(key); ok {
+		log.Println("[Get] Cache Hit!")
+		g.Stats.CacheHits.Add(1)
+		if stale {
+			g.refresh(MainCache, key)
+		}
+		return v, true, nil
+	}
+	if g.hotCacheEnabled() {
+		if v, stale, ok := g.hotCache.getStale(key); ok {
+			log.Println("[Get] Hot Cache Hit!")
+			g.Stats.CacheHits.Add(1)
+			if stale {
+				g.refresh(HotCache, key)
+			}
+			return v, true, nil
+		}
+	}
+	if g.negativeTTL > 0 {
+		if _, ok := g.missCache.get(key); ok {
+			log.Println("[Get] Negative Cache Hit!")
+			g.Stats.NegativeHits.Add(1)
+			return ByteView{}, true, &NotFoundError{Key: key}
+		}
+	}
+	return ByteView{}, false, nil
 }
 
 // 加载先看有没有节点，没有就在本地加载，否则去节点中调用 getFromGetter 函数
-func (g *Group) load(key string) (val ByteView, err error) {
-	// 将 load 用 singleflight 中的 do 包装
-	do, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
-				if val, err := g.getFromGetter(peer, key); err == nil {
-					return val, nil
+func (g *Group) load(ctx context.Context, key string) (val ByteView, err error) {
+	g.Stats.Loads.Add(1)
+	return g.loadOnce(ctx, key)
+}
+
+// loadOnce 与 load 相同，但不计入 Stats.Loads，供已经统计过的批量加载使用
+func (g *Group) loadOnce(ctx context.Context, key string) (val ByteView, err error) {
+	val, _, err = g.loadFrom(ctx, key)
+	return
+}
+
+// loaded 是 singleflight 共享的加载结果
+type loaded struct {
+	val ByteView
+	src LoadSource
+}
+
+// loadFrom 与 loadOnce 相同，同时返回值的来源。从远程节点获取的值不会写入 mainCache
+func (g *Group) loadFrom(ctx context.Context, key string) (val ByteView, src LoadSource, err error) {
+	// 将 load 用 singleflight 中的 do 包装，shared 表示结果被多个调用者共享，调用者放弃等待时为 false。
+	// ran 只在本次调用执行了 fn 时为 true，fn 结束后 DoContext 才返回结果，因此读取时不会与写入竞争
+	ran := false
+	do, err, shared := g.loader.DoContext(ctx, key, func() (interface{}, error) {
+		ran = true
+		// 共享的加载不应随发起者的 ctx 一起被取消，只保留 ctx 中的值
+		loadCtx, cancel := g.loadContext(ctx)
+		defer cancel()
+		if peers := g.peerPicker(); peers != nil {
+			if peer, ok := peers.PickPeer(key); ok {
+				start := time.Now()
+				val, err := g.getFromGetter(loadCtx, peer, key)
+				// 所属节点确认 key 不存在时，不需要再从本地数据源加载
+				if err == nil || IsNotFound(err) {
+					g.Stats.PeerLoads.Add(1)
+					g.onLoad(key, LoadFromPeer, err, start)
+					return loaded{val: val, src: LoadFromPeer}, err
 				}
+				g.Stats.PeerErrors.Add(1)
+				g.onPeerError(key, err)
 				log.Println("[load] getFromGetter failed! err: ", err)
 			}
 		}
 
-		return g.getLocally(key)
+		start := time.Now()
+		val, err := g.getLocally(loadCtx, key)
+		g.onLoad(key, LoadFromGetter, err, start)
+		if err != nil {
+			g.Stats.LocalLoadErrs.Add(1)
+			return nil, err
+		}
+		g.Stats.LocalLoads.Add(1)
+		return loaded{val: val, src: LoadFromGetter}, nil
 	})
+	// 只统计没有执行 fn、直接得到其他调用者加载结果的调用
+	if shared && !ran {
+		g.Stats.LoadsDeduped.Add(1)
+	}
 	if err == nil {
-		return do.(ByteView), nil
+		l := do.(loaded)
+		return l.val, l.src, nil
 	}
 	return
 }
 
-func (g *Group) getFromGetter(peer PeerGetter, key string) (ByteView, error) {
-	bytes, err := peer.Get(g.name, key)
+// loadContext 返回共享加载使用的 context：不随 parent 取消，但受 loadTimeout 限制
+func (g *Group) loadContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx := context.Context(detachedContext{parent})
+	if g.loadTimeout > 0 {
+		return context.WithTimeout(ctx, g.loadTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (g *Group) getFromGetter(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	req := &pb.Request{
+		Group: g.name,
+		Key:   key,
+	}
+	res := &pb.Response{}
+	var err error
+	if cp, ok := peer.(ContextPeerGetter); ok {
+		err = cp.GetContext(ctx, req, res)
+	} else {
+		err = peer.Get(req, res)
+	}
 	if err != nil {
 		log.Println("[getFromGetter] peer get error: ", err)
 		return ByteView{}, err
 	}
-	return ByteView{b: bytes}, err
+	val := ByteView{b: res.Value}
+	// 按采样率将远程获取的值放入 hotCache
+	if g.hotCacheEnabled() && rand.Intn(g.hotSampleRate) == 0 {
+		g.addToHotCache(key, val)
+	}
+	return val, nil
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+func (g *Group) hotCacheEnabled() bool {
+	return g.hotSampleRate > 0 && g.hotCache.bytes() > 0
+}
+
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var (
+		bytes []byte
+		ttl   time.Duration
+		err   error
+	)
+	// TTLGetter 优先于 ContextGetter，同时实现两者时不能丢失每个 key 的过期时间
+	switch getter := g.getter.(type) {
+	case ContextTTLGetter:
+		bytes, ttl, err = getter.GetWithTTLContext(ctx, key)
+	case TTLGetter:
+		bytes, ttl, err = getter.GetWithTTL(key)
+	case ContextGetter:
+		bytes, err = getter.GetContext(ctx, key)
+	default:
+		bytes, err = g.getter.Get(key)
+	}
 	if err != nil {
+		if IsNotFound(err) {
+			g.addMiss(key)
+		}
 		return ByteView{}, err
 	}
 	val := ByteView{b: cloneBytes(bytes)}
-	g.addToCache(key, val)
+	g.addToCache(key, val, ttl)
 	return val, nil
 }
 
-func (g *Group) addToCache(key string, val ByteView) {
-	g.mainCache.add(key, val)
+// addMiss 将数据源中不存在的 key 加入 missCache
+func (g *Group) addMiss(key string) {
+	if g.negativeTTL > 0 {
+		g.missCache.add(key, ByteView{}, time.Now().Add(g.negativeTTL))
+	}
 }
 
-func (g *Group) RegisterPeers(picker PeerPicker) {
-	if g.peers != nil {
-		panic("[RegisterPeers] func called more than once!")
+// addToCache 将值加入 mainCache，ttl <= 0 时使用 Group 的默认过期时间
+func (g *Group) addToCache(key string, val ByteView, ttl time.Duration) {
+	g.missCache.remove(key)
+	expire := g.expireAt(ttl)
+	g.mainCache.addWithRefresh(key, val, expire, g.refreshAt(expire))
+}
+
+// addToHotCache 将远程获取的值放入 hotCache，使用 Group 的默认过期时间
+func (g *Group) addToHotCache(key string, val ByteView) {
+	expire := g.expireAt(0)
+	g.hotCache.addWithRefresh(key, val, expire, g.refreshAt(expire))
+}
+
+// expireAt 计算过期时间，ttl <= 0 时使用 Group 的默认过期时间，返回零值表示永不过期
+func (g *Group) expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// CacheType 表示 Group 中的某一个 cache
+type CacheType int
+
+const (
+	MainCache CacheType = iota + 1	// 本节点作为所属节点缓存的值
+	HotCache						// 从远程节点获取的热点副本
+	MissCache						// 数据源中不存在的 key
+)
+
+// CacheStats 返回指定 cache 的统计信息
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	case MissCache:
+		return g.missCache.stats()
+	default:
+		return CacheStats{}
+	}
+}
+
+// Remove 使 key 在整个集群中失效：先删除本地缓存，再通知 key 所属节点删除，
+// 最后广播给其余节点，删除它们 hotCache 中的副本以及远程获取失败时回退到本地加载而缓存的值。
+func (g *Group) Remove(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is empty")
+	}
+	g.removeLocally(key)
+	peers := g.peerPicker()
+	if peers == nil {
+		return nil
+	}
+
+	// 先删除所属节点上的值，否则其他节点可能在广播期间又从所属节点取回旧值
+	req := &pb.Request{
+		Group: g.name,
+		Key:   key,
+	}
+	owner, ok := pickOwner(peers, key)
+	if ok {
+		if err := owner.Remove(req); err != nil {
+			return err
+		}
+	}
+
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		rerr    error
+	)
+	for _, peer := range peers.GetAll() {
+		if peer == owner {
+			continue
+		}
+		wg.Add(1)
+		go func(peer PeerGetter) {
+			defer wg.Done()
+			if err := peer.Remove(req); err != nil {
+				log.Println("[Remove] peer remove error: ", err)
+				errOnce.Do(func() { rerr = err })
+			}
+		}(peer)
+	}
+	wg.Wait()
+	return rerr
+}
+
+// Set 将 key 的值写入所属节点的缓存中，getter 实现了 Setter 时同时更新数据源。
+// 其他节点 hotCache 中的旧副本不会被删除，会在过期后失效；需要立即失效时应使用 Remove。
+func (g *Group) Set(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key is empty")
+	}
+	if peers := g.peerPicker(); peers != nil {
+		if peer, ok := pickOwner(peers, key); ok {
+			err := peer.Set(&pb.Request{
+				Group: g.name,
+				Key:   key,
+				Value: value,
+			})
+			if err != nil {
+				log.Println("[Set] peer set error: ", err)
+				return err
+			}
+			// 本地可能存有旧值的副本
+			g.removeLocally(key)
+			return nil
+		}
+	}
+	if err := g.setLocally(key, value); err != nil {
+		return err
+	}
+	return g.setReplicas(key, value)
+}
+
+// pickOwner 选择写入与删除 key 时的所属节点，peers 实现了 OwnerPicker 时使用 PickOwner
+func pickOwner(peers PeerPicker, key string) (PeerGetter, bool) {
+	if op, ok := peers.(OwnerPicker); ok {
+		return op.PickOwner(key)
+	}
+	return peers.PickPeer(key)
+}
+
+// setReplicas 在本节点是 key 的副本之一时，将值写入其余副本所在的节点
+func (g *Group) setReplicas(key string, value []byte) error {
+	rp, ok := g.peerPicker().(ReplicaPicker)
+	if !ok {
+		return nil
+	}
+	// 数据源已由本节点写入，其余副本只需更新缓存
+	req := &pb.Request{
+		Group:   g.name,
+		Key:     key,
+		Value:   value,
+		Replica: true,
+	}
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		rerr    error
+	)
+	for _, peer := range rp.PickReplicas(key) {
+		wg.Add(1)
+		go func(peer PeerGetter) {
+			defer wg.Done()
+			if err := peer.Set(req); err != nil {
+				log.Println("[Set] replica set error: ", err)
+				errOnce.Do(func() { rerr = err })
+			}
+		}(peer)
+	}
+	wg.Wait()
+	return rerr
+}
+
+// setLocally 在本节点作为所属节点时写入缓存与数据源
+func (g *Group) setLocally(key string, value []byte) error {
+	val := ByteView{b: cloneBytes(value)}
+	setter, ok := g.getter.(Setter)
+	if !ok {
+		g.addToCache(key, val, 0)
+		return nil
+	}
+
+	if g.writeMode == WriteBehind && g.writes != nil {
+		// 持有读锁入队，writeBehind 关闭队列前会等待入队完成，因此入队成功的值一定会被写入；
+		// 队列满时在 Group 被销毁后放弃等待
+		g.writesMu.RLock()
+		if g.writesClosed {
+			g.writesMu.RUnlock()
+			return errGroupDestroyed
+		}
+		select {
+		case g.writes <- pendingWrite{key: key, value: val.ByteSlice()}:
+		case <-g.stop:
+			g.writesMu.RUnlock()
+			return errGroupDestroyed
+		}
+		g.writesMu.RUnlock()
+		g.addToCache(key, val, 0)
+		return nil
+	}
+
+	if err := setter.Set(key, val.ByteSlice()); err != nil {
+		return err
 	}
+	g.addToCache(key, val, 0)
+	return nil
+}
+
+// setFromPeer 处理远程节点发来的写入，副本写入只更新缓存，其余与 setLocally 相同
+func (g *Group) setFromPeer(key string, in *pb.Request) error {
+	if in.GetReplica() {
+		g.addToCache(key, ByteView{b: cloneBytes(in.GetValue())}, 0)
+		return nil
+	}
+	return g.setLocally(key, in.GetValue())
+}
+
+// writeBehind 将队列中的值依次写入数据源，写入失败时只记录日志
+func (g *Group) writeBehind() {
+	defer close(g.writesDone)
+	setter := g.getter.(Setter)
+	for {
+		select {
+		case w := <-g.writes:
+			if err := setter.Set(w.key, w.value); err != nil {
+				log.Printf("[writeBehind] group %s set key %s error: %v", g.name, w.key, err)
+			}
+		case <-g.stop:
+			g.writesMu.Lock()
+			g.writesClosed = true
+			g.writesMu.Unlock()
+			g.flushWrites(setter)
+			return
+		}
+	}
+}
+
+// flushWrites 在 Group 被销毁时写入队列中剩余的值
+func (g *Group) flushWrites(setter Setter) {
+	for {
+		select {
+		case w := <-g.writes:
+			if err := setter.Set(w.key, w.value); err != nil {
+				log.Printf("[writeBehind] group %s set key %s error: %v", g.name, w.key, err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (g *Group) removeLocally(key string) {
+	// 正在进行的加载可能读到旧值，之后的 Get 不应再共享它的结果
+	g.loader.Forget(key)
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	g.missCache.remove(key)
+}
+
+// RegisterPeers 设置选择远程节点的 PeerPicker，可以多次调用以更换节点列表或通信方式，
+// picker 为 nil 时只从本地加载。已经开始的加载仍使用原来的 PeerPicker
+func (g *Group) RegisterPeers(picker PeerPicker) {
+	g.peersMu.Lock()
+	defer g.peersMu.Unlock()
 	g.peers = picker
-}
\ No newline at end of file
+}
+
+// peerPicker 返回当前的 PeerPicker，未注册时返回 nil
+func (g *Group) peerPicker() PeerPicker {
+	g.peersMu.RLock()
+	defer g.peersMu.RUnlock()
+	return g.peers
+}
+
+// detachedContext 保留 parent 中的值，但不继承其截止时间与取消信号
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
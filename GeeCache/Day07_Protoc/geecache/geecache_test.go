@@ -1,10 +1,13 @@
 package geecache
 
 import (
+	"context"
 	"fmt"
+	pb "geecache/geecachepb"
 	"log"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -76,4 +79,589 @@ func TestGet(t *testing.T)  {
 	if view, err := group.Get("unknown"); err == nil {
 		t.Fatalf("the value of unknow should be empty, but %s got", view)
 	}
-}
\ No newline at end of file
+}
+
+func TestGetWithTTL(t *testing.T) {
+	loads := 0
+	group := NewGroup("ttl", 2<<10, TTLGetterFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			loads++
+			if key == "short" {
+				return []byte(key), 10 * time.Millisecond, nil
+			}
+			return []byte(key), 0, nil
+		}), WithTTL(time.Hour), WithSweepInterval(0))
+
+	for _, key := range []string{"short", "long"} {
+		if _, err := group.Get(key); err != nil {
+			t.Fatalf("failed to get %s: %v", key, err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := group.Get("long"); err != nil || loads != 2 {
+		t.Fatalf("long should use default ttl and hit cache, loads: %d", loads)
+	}
+	if _, err := group.Get("short"); err != nil || loads != 3 {
+		t.Fatalf("short should expire and reload, loads: %d", loads)
+	}
+
+	// 同时实现 ContextGetter 与 TTLGetter 时保留每个 key 的过期时间
+	both := &contextTTLSource{}
+	group = NewGroup("ttl-context", 2<<10, both, WithTTL(time.Hour), WithSweepInterval(0))
+	group.Get("short")
+	time.Sleep(20 * time.Millisecond)
+	if group.Get("short"); both.loads != 2 {
+		t.Fatalf("per-key ttl should be kept, loads: %d", both.loads)
+	}
+
+	// ContextTTLGetter 同时收到 ctx 并指定过期时间
+	type ctxKey struct{}
+	var got []interface{}
+	group = NewGroup("ttl-context-func", 2<<10, ContextTTLGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+			got = append(got, ctx.Value(ctxKey{}))
+			return []byte(key), 10 * time.Millisecond, nil
+		}), WithTTL(time.Hour), WithSweepInterval(0))
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	group.GetContext(ctx, "short")
+	time.Sleep(20 * time.Millisecond)
+	if group.GetContext(ctx, "short"); len(got) != 2 || got[0] != "v" {
+		t.Fatalf("ContextTTLGetter should get ctx and ttl, got %v", got)
+	}
+}
+
+// contextTTLSource 分别实现了 ContextGetter 与 TTLGetter，只有 GetWithTTL 会被调用
+type contextTTLSource struct {
+	loads int
+}
+
+func (s *contextTTLSource) Get(key string) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+func (s *contextTTLSource) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return nil, fmt.Errorf("GetContext should not be called")
+}
+
+func (s *contextTTLSource) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	s.loads++
+	return []byte(key), 10 * time.Millisecond, nil
+}
+
+// fakePeer 模拟远程节点，记录收到的请求
+type fakePeer struct {
+	mu      sync.Mutex
+	values  map[string]string
+	gets    int
+	removed []string
+}
+
+func (p *fakePeer) Get(in *pb.Request, out *pb.Response) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gets++
+	if v, ok := p.values[in.Key]; ok {
+		out.Value = []byte(v)
+		return nil
+	}
+	return fmt.Errorf("fakePeer: get %s/%s", in.Group, in.Key)
+}
+
+func (p *fakePeer) Set(in *pb.Request) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.values == nil {
+		p.values = make(map[string]string)
+	}
+	p.values[in.Key] = string(in.Value)
+	return nil
+}
+
+func (p *fakePeer) Remove(in *pb.Request) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removed = append(p.removed, in.Group+"/"+in.Key)
+	return nil
+}
+
+type fakePicker struct {
+	owner *fakePeer
+	all   []*fakePeer
+}
+
+func (f *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	if f.owner == nil {
+		return nil, false
+	}
+	return f.owner, true
+}
+
+func (f *fakePicker) GetAll() []PeerGetter {
+	peers := make([]PeerGetter, 0, len(f.all))
+	for _, p := range f.all {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+func TestRemove(t *testing.T) {
+	loads := 0
+	group := NewGroup("remove", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}))
+	owner, other := &fakePeer{}, &fakePeer{}
+	group.RegisterPeers(&fakePicker{owner: owner, all: []*fakePeer{owner, other}})
+
+	// owner 获取失败，回退到本地加载并缓存
+	if _, err := group.Get("Tom"); err != nil || loads != 1 {
+		t.Fatalf("failed to load Tom locally, loads: %d", loads)
+	}
+	if err := group.Remove("Tom"); err != nil {
+		t.Fatalf("remove Tom failed: %v", err)
+	}
+	if _, ok := group.mainCache.get("Tom"); ok {
+		t.Fatal("Tom should be removed from local cache")
+	}
+	for _, p := range []*fakePeer{owner, other} {
+		if !reflect.DeepEqual(p.removed, []string{"remove/Tom"}) {
+			t.Fatalf("peer should receive exactly one remove, got %v", p.removed)
+		}
+	}
+}
+
+func TestHotCache(t *testing.T) {
+	group := NewGroup("hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("key %s should be loaded from peer", key)
+			return nil, nil
+		}), WithHotCache(1<<10, 1))
+	owner := &fakePeer{values: db}
+	group.RegisterPeers(&fakePicker{owner: owner, all: []*fakePeer{owner}})
+
+	for i := 0; i < 3; i++ {
+		if view, err := group.Get("Tom"); err != nil || view.String() != db["Tom"] {
+			t.Fatalf("failed to get Tom from peer: %v", err)
+		}
+	}
+	if owner.gets != 1 {
+		t.Fatalf("hot key should be fetched from peer once, got %d", owner.gets)
+	}
+	if stats := group.CacheStats(HotCache); stats.Items != 1 || stats.Hits != 2 {
+		t.Fatalf("unexpected hot cache stats: %+v", stats)
+	}
+	if stats := group.CacheStats(MainCache); stats.Items != 0 {
+		t.Fatalf("peer value should not be stored in main cache: %+v", stats)
+	}
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	for name, policy := range map[string]PolicyFactory{
+		"lru": LRUPolicy, "lfu": LFUPolicy, "arc": ARCPolicy, "2q": TwoQueuePolicy,
+	} {
+		loads := 0
+		group := NewGroup("policy-"+name, 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				loads++
+				return []byte(key), nil
+			}), WithEvictionPolicy(policy))
+		for i := 0; i < 2; i++ {
+			if view, err := group.Get("Tom"); err != nil || view.String() != "Tom" {
+				t.Fatalf("%s: failed to get Tom: %v", name, err)
+			}
+		}
+		if loads != 1 {
+			t.Fatalf("%s: Tom should be cached, loads: %d", name, loads)
+		}
+	}
+}
+
+// mapSource 是同时实现了 Getter 与 Setter 的数据源
+type mapSource struct {
+	mu   sync.Mutex
+	data map[string]string
+	sets chan string
+}
+
+func (s *mapSource) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.data[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%s not exist", key)
+}
+
+func (s *mapSource) Set(key string, value []byte) error {
+	s.mu.Lock()
+	s.data[key] = string(value)
+	s.mu.Unlock()
+	if s.sets != nil {
+		s.sets <- key
+	}
+	return nil
+}
+
+func TestSet(t *testing.T) {
+	src := &mapSource{data: map[string]string{"Tom": "630"}}
+	group := NewGroup("set", 2<<10, src)
+	if _, err := group.Get("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if err := group.Set("Tom", []byte("700")); err != nil {
+		t.Fatalf("set Tom failed: %v", err)
+	}
+	if view, _ := group.mainCache.get("Tom"); view.String() != "700" || src.data["Tom"] != "700" {
+		t.Fatalf("write-through should update cache and source, got %q / %q", view.String(), src.data["Tom"])
+	}
+
+	behind := &mapSource{data: map[string]string{}, sets: make(chan string, 1)}
+	group = NewGroup("set-behind", 2<<10, behind, WithWriteMode(WriteBehind, 8))
+	if err := group.Set("Jack", []byte("589")); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := group.Get("Jack"); err != nil || view.String() != "589" {
+		t.Fatalf("write-behind should update cache first, got %q, %v", view.String(), err)
+	}
+	select {
+	case <-behind.sets:
+	case <-time.After(time.Second):
+		t.Fatal("write-behind should eventually update the source")
+	}
+
+	owner := &fakePeer{}
+	group = NewGroup("set-peer", 2<<10, src)
+	group.RegisterPeers(&fakePicker{owner: owner, all: []*fakePeer{owner}})
+	if err := group.Set("Sam", []byte("567")); err != nil || owner.values["Sam"] != "567" {
+		t.Fatalf("set should be routed to the owner, got %v, %v", owner.values, err)
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	release := make(chan struct{})
+	var calls AtomicInt
+	gee := NewGroup("context", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			calls.Add(1)
+			select {
+			case <-release:
+				return []byte("v-" + key), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}), WithLoadTimeout(time.Second))
+
+	// 调用者超时后立即返回，共享的加载不受影响
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := gee.GetContext(ctx, "k"); err != context.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	if v, err := gee.Get("k"); err != nil || v.String() != "v-k" {
+		t.Fatalf("get k = %q, %v", v.String(), err)
+	}
+	if calls.Get() != 1 {
+		t.Fatalf("getter called %d times, want 1", calls.Get())
+	}
+	// 放弃等待的调用者没有共享结果，不计入 LoadsDeduped
+	if n := gee.Stats.LoadsDeduped.Get(); n != 0 {
+		t.Fatalf("abandoned load should not count as deduped, got %d", n)
+	}
+
+	// 同时加载同一个 key 的调用者共享一次加载，只有没有执行加载的 2 个调用者计入 LoadsDeduped
+	var shared *Group
+	shared = NewGroup("context-shared", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		// 等到另外 2 个调用者都在等待这次加载后再返回
+		for shared.loader.Dups(key) < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		return []byte(key), nil
+	}))
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shared.Get("k")
+		}()
+	}
+	wg.Wait()
+	if loads, deduped := shared.Stats.LocalLoads.Get(), shared.Stats.LoadsDeduped.Get(); loads != 1 || deduped != 2 {
+		t.Fatalf("expect 1 load shared by 3 callers, got %d loads, %d deduped", loads, deduped)
+	}
+
+	// 加载超时会传递给 Getter
+	slow := NewGroup("context-timeout", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}), WithLoadTimeout(10*time.Millisecond))
+	if _, err := slow.Get("k"); err != context.DeadlineExceeded {
+		t.Fatalf("expected load timeout, got %v", err)
+	}
+}
+
+func TestGetterPanic(t *testing.T) {
+	var calls AtomicInt
+	gee := NewGroup("panic", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if calls.Add(1); calls.Get() == 1 {
+				panic("getter failed")
+			}
+			return []byte(key), nil
+		}))
+	if _, err := gee.Get("k"); err == nil {
+		t.Fatal("expected error from panicking getter")
+	}
+	if v, err := gee.Get("k"); err != nil || v.String() != "k" {
+		t.Fatalf("get after panic = %q, %v", v.String(), err)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	var loads AtomicInt
+	gee := NewGroup("negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads.Add(1)
+			return nil, &NotFoundError{Key: key}
+		}), WithNegativeTTL(50*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("unknown"); !IsNotFound(err) {
+			t.Fatalf("expected NotFoundError, got %v", err)
+		}
+	}
+	if loads.Get() != 1 || gee.Stats.NegativeHits.Get() != 2 {
+		t.Fatalf("loads = %d, negative hits = %d", loads.Get(), gee.Stats.NegativeHits.Get())
+	}
+
+	// 未命中记录过期后重新访问数据源
+	time.Sleep(60 * time.Millisecond)
+	gee.Get("unknown")
+	if loads.Get() != 2 {
+		t.Fatalf("negative entry should expire, loads = %d", loads.Get())
+	}
+
+	// Set 之后不再返回未命中
+	if err := gee.Set("unknown", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := gee.Get("unknown"); err != nil || v.String() != "v" {
+		t.Fatalf("get after set = %q, %v", v.String(), err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var (
+		mu                         sync.Mutex
+		evicted, expired, peerErrs []string
+		loads                      = make(map[string]LoadSource)
+	)
+	hooks := Hooks{
+		OnEvict: func(which CacheType, key string, value ByteView) {
+			mu.Lock()
+			defer mu.Unlock()
+			evicted = append(evicted, key)
+		},
+		OnExpire: func(which CacheType, key string, value ByteView) {
+			mu.Lock()
+			defer mu.Unlock()
+			expired = append(expired, key)
+		},
+		OnLoad: func(key string, source LoadSource, err error, elapsed time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			loads[key] = source
+		},
+		OnPeerError: func(key string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			peerErrs = append(peerErrs, key)
+		},
+	}
+	// 只能容纳一个值，"Tom" 与 "Jack" 互相淘汰
+	group := NewGroup("hooks", 8, TTLGetterFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			if key == "short" {
+				return []byte("v"), 10 * time.Millisecond, nil
+			}
+			return []byte(db[key]), 0, nil
+		}), WithShards(1), WithSweepInterval(0), WithHooks(hooks))
+	// 所属节点上不存在任何值，获取会失败并回退到本地加载
+	owner := &fakePeer{}
+	group.RegisterPeers(&fakePicker{owner: owner, all: []*fakePeer{owner}})
+
+	for _, key := range []string{"Tom", "Jack", "short"} {
+		if _, err := group.Get(key); err != nil {
+			t.Fatalf("failed to get %s: %v", key, err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := group.Get("short"); err != nil {
+		t.Fatalf("failed to reload short: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(evicted, []string{"Tom", "Jack"}) {
+		t.Fatalf("unexpected evictions: %v", evicted)
+	}
+	if !reflect.DeepEqual(expired, []string{"short"}) {
+		t.Fatalf("unexpected expirations: %v", expired)
+	}
+	if len(peerErrs) != 4 || len(loads) != 3 || loads["Tom"] != LoadFromGetter {
+		t.Fatalf("unexpected loads: %v, peer errors: %v", loads, peerErrs)
+	}
+}
+
+func TestGroupLifecycle(t *testing.T) {
+	behind := &mapSource{data: map[string]string{}, sets: make(chan string, 1)}
+	NewGroup("tenant-a", 2<<10, behind, WithWriteMode(WriteBehind, 8), WithTTL(time.Minute))
+	b := NewGroup("tenant-b", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v"), nil
+	}), WithShards(1))
+
+	names := ListGroups()
+	found := 0
+	for _, name := range names {
+		if name == "tenant-a" || name == "tenant-b" {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Fatalf("ListGroups should contain both tenants, got %v", names)
+	}
+
+	// DestroyGroup 在 WriteBehind 队列中的值写入数据源之后才返回
+	if err := GetGroup("tenant-a").Set("Tom", []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	if !DestroyGroup("tenant-a") || GetGroup("tenant-a") != nil {
+		t.Fatal("tenant-a should be destroyed")
+	}
+	select {
+	case <-behind.sets:
+	default:
+		t.Fatal("pending writes should be flushed before DestroyGroup returns")
+	}
+	if DestroyGroup("tenant-a") {
+		t.Fatal("destroying twice should report false")
+	}
+
+	// 数据源阻塞、队列已满时销毁，等待入队的 Set 返回错误而不是一直阻塞
+	blocked := &mapSource{data: map[string]string{}, sets: make(chan string)}
+	c := NewGroup("tenant-c", 2<<10, blocked, WithWriteMode(WriteBehind, 1))
+	c.Set("k1", []byte("v"))
+	c.Set("k2", []byte("v"))
+	done := make(chan error, 1)
+	go func() { done <- c.Set("k3", []byte("v")) }()
+	destroyed := make(chan bool)
+	go func() { destroyed <- DestroyGroup("tenant-c") }()
+	select {
+	case err := <-done:
+		if err != errGroupDestroyed {
+			t.Fatalf("set after destroy should fail, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("set after destroy should not block")
+	}
+	for i := 0; i < 2; i++ {
+		<-blocked.sets
+	}
+	<-destroyed
+	if err := c.Set("k4", []byte("v")); err != errGroupDestroyed {
+		t.Fatalf("set after the queue is closed should fail, got %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		b.Get(fmt.Sprintf("k%d", i))
+	}
+	b.SetCacheBytes(3 * int64(len("k0v")))
+	if stats := b.mainCache.stats(); stats.Items != 3 || stats.Evictions != 7 {
+		t.Fatalf("SetCacheBytes should trim mainCache, got %+v", stats)
+	}
+	if _, ok := b.mainCache.get("k9"); !ok {
+		t.Fatal("most recently used keys should be kept")
+	}
+
+	// RegisterPeers 可以多次调用，nil 表示只从本地加载
+	owner := &fakePeer{values: map[string]string{"Sam": "peer"}}
+	b.RegisterPeers(&fakePicker{owner: owner, all: []*fakePeer{owner}})
+	if v, err := b.Get("Sam"); err != nil || v.String() != "peer" {
+		t.Fatalf("Sam should be loaded from the peer, got %q, %v", v.String(), err)
+	}
+	b.RegisterPeers(nil)
+	b.Remove("Sam")
+	if v, err := b.Get("Sam"); err != nil || v.String() != "v" || owner.gets != 1 {
+		t.Fatalf("Sam should be loaded locally after unregistering peers, got %q, %v", v.String(), err)
+	}
+}
+
+func TestSoftTTL(t *testing.T) {
+	var (
+		loads int32
+		gate  = make(chan struct{})
+	)
+	group := NewGroup("soft-ttl", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			n := atomic.AddInt32(&loads, 1)
+			if n > 1 {
+				<-gate // 模拟缓慢的数据源
+			}
+			return []byte(fmt.Sprintf("v%d", n)), nil
+		}), WithTTL(time.Hour), WithSoftTTL(10*time.Millisecond), WithSweepInterval(0))
+
+	if v, err := group.Get("Tom"); err != nil || v.String() != "v1" {
+		t.Fatalf("first get = %q, %v", v.String(), err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// 软过期后不等待数据源，直接返回旧值，多次访问只触发一次刷新
+	for i := 0; i < 3; i++ {
+		if v, err := group.Get("Tom"); err != nil || v.String() != "v1" {
+			t.Fatalf("stale get = %q, %v", v.String(), err)
+		}
+	}
+	close(gate)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, _ := group.mainCache.get("Tom"); v.String() == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("value should be refreshed in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("expect one background refresh, got %d loads", n)
+	}
+	if stats := group.StatsSnapshot(); stats.StaleHits != 3 || stats.Refreshes != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	// mainCache 中的旧值改由远程节点刷新时，新值同样写回 mainCache
+	owner := &fakePeer{values: map[string]string{"Sam": "peer"}}
+	moved := NewGroup("soft-ttl-moved", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, &NotFoundError{Key: key}
+	}), WithSoftTTL(10*time.Millisecond), WithSweepInterval(0))
+	moved.Set("Sam", []byte("local"))
+	moved.RegisterPeers(&fakePicker{owner: owner})
+	time.Sleep(20 * time.Millisecond)
+	if v, err := moved.Get("Sam"); err != nil || v.String() != "local" {
+		t.Fatalf("stale get = %q, %v", v.String(), err)
+	}
+	deadline = time.Now().Add(time.Second)
+	for {
+		if v, _ := moved.mainCache.get("Sam"); v.String() == "peer" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("value refreshed from the peer should replace the stale mainCache entry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
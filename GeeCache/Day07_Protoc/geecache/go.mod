@@ -1,3 +1,5 @@
 module geecache
 
-go 1.13
\ No newline at end of file
+go 1.13
+
+require google.golang.org/protobuf v1.27.1
@@ -0,0 +1,96 @@
+package geecache
+
+import (
+	"sync"
+	"time"
+)
+
+// 熔断器的三种状态
+const (
+	circuitClosed   = iota // 正常，允许请求
+	circuitOpen            // 连续失败过多，拒绝请求直到冷却结束
+	circuitHalfOpen        // 冷却结束，只放行一个探测请求
+)
+
+const (
+	defaultPeerTimeout      = 2 * time.Second
+	defaultFailureThreshold = 3
+	defaultCooldown         = 10 * time.Second
+)
+
+// peerHealth 记录一个远程节点的健康状况，实现简单的熔断：
+// 连续失败 threshold 次后熔断 cooldown 时长，在此期间 PickPeer 会跳过该节点；
+// 冷却结束后放行一个探测请求，成功则恢复，失败则继续熔断。
+type peerHealth struct {
+	mu        sync.Mutex
+	state     int
+	failures  int       // 连续失败次数
+	openUntil time.Time // 熔断结束时间
+	threshold int
+	cooldown  time.Duration
+}
+
+func newPeerHealth(threshold int, cooldown time.Duration) *peerHealth {
+	return &peerHealth{threshold: threshold, cooldown: cooldown}
+}
+
+// healthy 返回节点当前是否可用，不改变熔断状态
+func (h *peerHealth) healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch h.state {
+	case circuitOpen:
+		return !time.Now().Before(h.openUntil)
+	case circuitHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// allow 判断是否可以向该节点发送请求，冷却结束后第一个请求会作为探测请求放行
+func (h *peerHealth) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch h.state {
+	case circuitOpen:
+		if time.Now().Before(h.openUntil) {
+			return false
+		}
+		h.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// success 记录一次成功请求，节点恢复正常
+func (h *peerHealth) success() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state = circuitClosed
+	h.failures = 0
+}
+
+// failure 记录一次失败请求，连续失败次数达到阈值或探测失败时熔断
+func (h *peerHealth) failure() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures++
+	if h.state == circuitHalfOpen || (h.threshold > 0 && h.failures >= h.threshold) {
+		h.state = circuitOpen
+		h.openUntil = time.Now().Add(h.cooldown)
+	}
+}
+
+// abandon 在请求被调用方取消、没有得到结果时调用。被放弃的若是探测请求，节点回到熔断状态，
+// 由于冷却已经结束，下一个请求会重新作为探测请求放行；否则不改变状态
+func (h *peerHealth) abandon() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.state == circuitHalfOpen {
+		h.state = circuitOpen
+	}
+}
@@ -0,0 +1,65 @@
+package geecache
+
+import "time"
+
+// LoadSource 表示一次加载的数据来源
+type LoadSource int
+
+const (
+	LoadFromPeer   LoadSource = iota + 1 // 从 key 所属的远程节点获取
+	LoadFromGetter                       // 通过 Getter 从数据源加载
+)
+
+// Hooks 是 Group 级别的事件回调，未设置的回调不会被调用。
+// 回调在触发事件的协程中同步执行，不持有 cache 的锁，但应尽快返回，避免拖慢 Get
+type Hooks struct {
+	// OnEvict 在 mainCache 或 hotCache 因容量不足淘汰一个值时调用，主动删除不会触发
+	OnEvict func(which CacheType, key string, value ByteView)
+	// OnExpire 在值过期被删除时调用，包括访问时的惰性删除与后台清理
+	OnExpire func(which CacheType, key string, value ByteView)
+	// OnLoad 在每次缓存未命中的加载结束后调用，err 不为 nil 时表示加载失败
+	OnLoad func(key string, source LoadSource, err error, elapsed time.Duration)
+	// OnPeerError 在从远程节点获取失败时调用，之后会回退到本地加载
+	OnPeerError func(key string, err error)
+}
+
+// WithHooks 设置 Group 的事件回调
+func WithHooks(hooks Hooks) GroupOption {
+	return func(g *Group) {
+		g.hooks = hooks
+	}
+}
+
+// registerCacheHooks 将 OnEvict 与 OnExpire 注册到 mainCache 与 hotCache 中
+func (g *Group) registerCacheHooks() {
+	for _, c := range []struct {
+		which CacheType
+		cache *cache
+	}{{MainCache, &g.mainCache}, {HotCache, &g.hotCache}} {
+		which := c.which
+		if g.hooks.OnEvict != nil {
+			c.cache.onEvict = func(key string, value ByteView) {
+				g.hooks.OnEvict(which, key, value)
+			}
+		}
+		if g.hooks.OnExpire != nil {
+			c.cache.onExpire = func(key string, value ByteView) {
+				g.hooks.OnExpire(which, key, value)
+			}
+		}
+	}
+}
+
+// onLoad 调用 OnLoad 回调，start 为加载开始的时间
+func (g *Group) onLoad(key string, source LoadSource, err error, start time.Time) {
+	if g.hooks.OnLoad != nil {
+		g.hooks.OnLoad(key, source, err, time.Since(start))
+	}
+}
+
+// onPeerError 调用 OnPeerError 回调
+func (g *Group) onPeerError(key string, err error) {
+	if g.hooks.OnPeerError != nil {
+		g.hooks.OnPeerError(key, err)
+	}
+}
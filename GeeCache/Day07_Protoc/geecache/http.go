@@ -1,20 +1,42 @@
 package geecache
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"geecache/consistenthash"
+	pb "geecache/geecachepb"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 
 // 创建具体的 HTTP 客户端类 httpGetter
 type httpGetter struct {
 	baseURL string	// baseURL 表示将要访问的远程节点的地址，例如 http://example.com/_geecache/。
+	client	*http.Client	// 带有超时时间，避免请求宕机节点时一直等待
+	health	*peerHealth	// 记录该节点的健康状况
+	peer	string		// 远程节点的地址
+	loads	loadTracker	// 不为 nil 时在请求期间增加该节点的负载
+	auth	*peerAuth	// 不为 nil 时以 self 的身份对请求签名
+	self	string		// 本节点的地址
+}
+
+// loadTracker 由需要感知节点负载的 Picker 实现，例如 consistenthash.Bounded
+type loadTracker interface {
+	Inc(node string)
+	Done(node string)
 }
 
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
@@ -23,69 +45,419 @@ type HTTPPool struct {
 	self		string	// 用来记录自己的地址，包括主机名/IP 和端口。
 	basePath	string	// 作为节点的通讯地址前缀，方便节点访问
 	mu			sync.Mutex
-	peers		*consistenthash.Map	// 一致性哈希的 map，通过 key 来选择节点
+	peers		consistenthash.Picker	// 一致性哈希的 map，通过 key 来选择节点
+	newPicker	func() consistenthash.Picker	// 创建 peers，默认为带虚拟节点的一致性哈希
 	// 每一个远程节点对应一个 httpGetter，因为 httpGetter 与远程节点的地址 baseURL 有关。
 	httpGetters	map[string]*httpGetter	// 映射远程节点与对应的 httpGetter
+	timeout		time.Duration	// 请求远程节点的超时时间
+	failureThreshold	int	// 连续失败多少次后熔断，<= 0 表示不熔断
+	cooldown	time.Duration	// 熔断持续时间
+	replication	int		// 每个 key 保存在哈希环上连续的几个节点上，<= 1 表示不复制
+	fanOutWrites	bool	// Set 是否同时写入所有副本
+	replicaGetters	map[string]*replicaGetter	// 按副本节点列表缓存 replicaGetter，节点变化时清空
+	auth		*peerAuth	// 节点间请求的签名密钥，为 nil 表示不签名
+	tlsConfig	*tls.Config	// 节点间的双向 TLS 配置，为 nil 表示不使用 TLS
+	transport	http.RoundTripper	// 所有 httpGetter 共用的 Transport，为 nil 时使用 http.DefaultTransport
 }
 
-func (h *httpGetter) Get(group string, key string) ([]byte, error) {
+// HTTPPoolOption 用于在 NewHTTPPool 时对 HTTPPool 进行可选配置
+type HTTPPoolOption func(*HTTPPool)
+
+// WithPeerTimeout 设置请求远程节点的超时时间
+func WithPeerTimeout(timeout time.Duration) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.timeout = timeout
+	}
+}
+
+// WithPicker 设置选择节点的策略，例如 consistenthash.NewBounded、NewJump 或 NewRendezvous。
+// consistenthash.Bounded 只影响读取时选择的节点，Set 与 Remove 通过 PickOwner 仍使用不考虑负载的哈希环
+func WithPicker(newPicker func() consistenthash.Picker) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.newPicker = newPicker
+	}
+}
+
+// WithCircuitBreaker 设置熔断策略：连续失败 threshold 次后，cooldown 时间内 PickPeer 跳过该节点
+func WithCircuitBreaker(threshold int, cooldown time.Duration) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.failureThreshold = threshold
+		p.cooldown = cooldown
+	}
+}
+
+// WithReplication 将每个 key 保存在哈希环上连续的 n 个节点上，读取时依次尝试各个副本。
+// fanOutWrites 为 true 时 Set 会写入全部 n 个副本，否则只写入第一个可用的副本，其余副本在过期后更新。
+// 数据源只由第一个写入成功的副本更新，其余副本只更新缓存
+func WithReplication(n int, fanOutWrites bool) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.replication = n
+		p.fanOutWrites = fanOutWrites
+	}
+}
+
+func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
+	return h.GetContext(context.Background(), in, out)
+}
+
+// newRequest 创建发往 /<basepath>/<group>/<key> 的请求，body 为 protobuf 编码的 in
+func (h *httpGetter) newRequest(ctx context.Context, method string, in *pb.Request) (*http.Request, []byte, error) {
 	u := fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
 		// QueryEscape 函数对s进行转码使之可以安全的用在URL查询里。
-		url.QueryEscape(group),
-		url.QueryEscape(key),
+		url.QueryEscape(in.GetGroup()),
+		url.QueryEscape(in.GetKey()),
 	)
-	res, err := http.Get(u) // 获取返回值
+	body, err := proto.Marshal(in)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", protobufContentType)
+	return req, body, nil
+}
+
+// GetContext 将 ctx 传递给 HTTP 请求，ctx 结束时请求会被取消
+func (h *httpGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	if h.loads != nil {
+		h.loads.Inc(h.peer)
+		defer h.loads.Done(h.peer)
+	}
+	req, body, err := h.newRequest(ctx, http.MethodGet, in)
+	if err != nil {
+		return err
+	}
+	res, err := h.do(req, body) // 获取返回值
+	if err != nil {
+		h.requestFailed(ctx)
+		return err
 	}
 	defer res.Body.Close()
 
+	bytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		h.requestFailed(ctx)
+		return fmt.Errorf("reading response body: %v", err)
+	}
+
+	if res.StatusCode == http.StatusNotFound && res.Header.Get("Content-Type") == protobufContentType &&
+		proto.Unmarshal(bytes, out) == nil && out.GetNotFound() {
+		// key 不存在是正常的结果，节点本身是健康的。其余的 404（例如路径错误或节点上没有该 group）视为节点出错
+		h.health.success()
+		return &NotFoundError{Key: in.GetKey()}
+	}
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned: %v", res.Status)
+		// 远程节点加载失败时会在 Response 中带回具体的错误信息，此时节点本身是健康的
+		if res.Header.Get("Content-Type") == protobufContentType &&
+			proto.Unmarshal(bytes, out) == nil && out.GetError() != "" {
+			h.health.success()
+			return errors.New(out.GetError())
+		}
+		h.health.failure()
+		return fmt.Errorf("server returned: %v", res.Status)
 	}
 
-	bytes, err := ioutil.ReadAll(res.Body)
+	if err = proto.Unmarshal(bytes, out); err != nil {
+		h.health.failure()
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	h.health.success()
+	return nil
+}
+
+// requestFailed 记录一次没有得到响应的请求。调用方主动取消不代表节点不健康，只放弃可能的探测请求；
+// 其余情况（包括 ctx 超时，例如 WithLoadTimeout 短于请求超时时节点无响应）都记为失败
+func (h *httpGetter) requestFailed(ctx context.Context) {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		h.health.abandon()
+		return
+	}
+	h.health.failure()
+}
+
+func (h *httpGetter) Remove(in *pb.Request) error {
+	req, body, err := h.newRequest(context.Background(), http.MethodDelete, in)
+	if err != nil {
+		return err
+	}
+	res, err := h.do(req, body)
+	if err != nil {
+		h.health.failure()
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		h.health.failure()
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	h.health.success()
+	return nil
+}
+
+// Set 以 PUT 请求将 protobuf 编码的 Request 发送给远程节点
+func (h *httpGetter) Set(in *pb.Request) error {
+	req, body, err := h.newRequest(context.Background(), http.MethodPut, in)
+	if err != nil {
+		return err
+	}
+	res, err := h.do(req, body)
+	if err != nil {
+		h.health.failure()
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		out := &pb.Response{}
+		if b, err := ioutil.ReadAll(res.Body); err == nil &&
+			proto.Unmarshal(b, out) == nil && out.GetError() != "" {
+			h.health.success()
+			return errors.New(out.GetError())
+		}
+		h.health.failure()
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	h.health.success()
+	return nil
+}
+
+// GetMulti 通过一次 POST 请求获取远程节点上的多个 key，body 为 protobuf 编码的 MultiRequest
+func (h *httpGetter) GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	u := fmt.Sprintf("%v%v/", h.baseURL, url.QueryEscape(in.GetGroup()))
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if h.loads != nil {
+		h.loads.Inc(h.peer)
+		defer h.loads.Done(h.peer)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", protobufContentType)
+	res, err := h.do(req, body)
 	if err != nil {
-		return nil, fmt.Errorf("reading response body: %v", err)
+		h.requestFailed(ctx)
+		return err
 	}
-	return bytes, nil
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		h.requestFailed(ctx)
+		return fmt.Errorf("reading response body: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		h.health.failure()
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	if err = proto.Unmarshal(b, out); err != nil {
+		h.health.failure()
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	h.health.success()
+	return nil
 }
 
 // Set 实例化一致性哈希， 添加传入节点
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers = p.newPicker()
 	p.peers.Add(peers...)
+	p.replicaGetters = nil
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+}
+
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	getter := &httpGetter{
+		baseURL: peer + p.basePath,
+		client:  &http.Client{Timeout: p.timeout, Transport: p.transport},
+		health:  newPeerHealth(p.failureThreshold, p.cooldown),
+		peer:    peer,
+		auth:    p.auth,
+		self:    p.self,
+	}
+	if loads, ok := p.peers.(loadTracker); ok {
+		getter.loads = loads
+	}
+	return getter
+}
+
+// AddPeer 在运行时加入节点，只会为新节点添加虚拟节点，不会重建整个哈希环
+func (p *HTTPPool) AddPeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		p.peers = p.newPicker()
+		p.httpGetters = make(map[string]*httpGetter)
+	}
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; ok {
+			continue
+		}
+		p.peers.Add(peer)
+		p.httpGetters[peer] = p.newGetter(peer)
+		p.replicaGetters = nil
+		p.Log("[AddPeer] peer %s joined", peer)
 	}
 }
 
+// RemovePeer 在运行时移除节点，原本属于该节点的 key 会自然地落到哈希环上的下一个节点
+func (p *HTTPPool) RemovePeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; !ok {
+			continue
+		}
+		p.peers.Remove(peer)
+		delete(p.httpGetters, peer)
+		p.replicaGetters = nil
+		p.Log("[RemovePeer] peer %s left", peer)
+	}
+}
+
+// Peers 返回当前所有节点，包括自己
+func (p *HTTPPool) Peers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]string, 0, len(p.httpGetters))
+	for peer := range p.httpGetters {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// SyncPeers 将节点列表更新为 peers，只对新增与离开的节点调用 AddPeer 和 RemovePeer
+func (p *HTTPPool) SyncPeers(peers []string) {
+	added, removed := diffPeers(p.Peers(), peers)
+	p.RemovePeer(removed...)
+	p.AddPeer(added...)
+}
+
 // PickPeer 包装了一致性哈希算法的 Get() 方法，根据具体的 key，选择节点，返回节点对应的 HTTP 客户端。
+// 所属节点被熔断时，顺着哈希环选择下一个健康的节点；若选中的是自己，则返回 false 由本地加载。
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+	if p.peers == nil {
+		return nil, false
+	}
+	if p.replication > 1 {
+		return p.pickReplicas(key)
+	}
+	return p.pick(p.peers, key)
+}
+
+// PickOwner 实现了 OwnerPicker，与 PickPeer 相同，但使用 WithPicker 选择了 consistenthash.Bounded 等
+// 依赖本地负载的策略时，按不考虑负载的哈希环选择节点，使所有节点的写入与删除落在同一个节点上
+func (p *HTTPPool) PickOwner(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if p.replication > 1 {
+		return p.pickReplicas(key)
+	}
+	return p.pick(p.ownerPeers(), key)
+}
+
+// ownerPeers 返回只由节点列表决定的 Picker，调用时需持有 p.mu
+func (p *HTTPPool) ownerPeers() consistenthash.Picker {
+	if u, ok := p.peers.(consistenthash.Unbounded); ok {
+		return u.Unbounded()
+	}
+	return p.peers
+}
+
+// pick 沿着 peers 的顺序选择第一个健康的节点，调用时需持有 p.mu
+func (p *HTTPPool) pick(peers consistenthash.Picker, key string) (PeerGetter, bool) {
+	var picked *httpGetter
+	peers.Walk(key, func(peer string) bool {
+		if peer == p.self {
+			return false
+		}
+		getter := p.httpGetters[peer]
+		if !getter.health.allow() {
+			p.Log("[PickPeer] skip unhealthy peer %s", peer)
+			return true
+		}
 		p.Log("[PickPeer] Pick peer %s", peer)
-		return p.httpGetters[peer], true
+		picked = getter
+		return false
+	})
+	if picked == nil {
+		return nil, false
 	}
-	return nil, false
+	return picked, true
+}
+
+// Healthy 返回各节点当前是否可用，不包括自己
+func (p *HTTPPool) Healthy() map[string]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	healthy := make(map[string]bool, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			healthy[peer] = getter.health.healthy()
+		}
+	}
+	return healthy
+}
+
+// GetAll 返回除自己以外所有节点对应的 HTTP 客户端
+func (p *HTTPPool) GetAll() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]PeerGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			getters = append(getters, getter)
+		}
+	}
+	return getters
 }
 
 const (
 	defaultBasePath = "/geeCache/"
+	defaultStatsPath = "/geeCacheStats/"	// 以 JSON 格式返回各个 group 的统计信息
+	protobufContentType = "application/x-protobuf"
 	defaultReplicas = 50
 )
 
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+func NewHTTPPool(self string, opts ...HTTPPoolOption) *HTTPPool {
+	p := &HTTPPool{
 		self:    	self,
 		basePath: 	defaultBasePath,
+		timeout:          defaultPeerTimeout,
+		failureThreshold: defaultFailureThreshold,
+		cooldown:         defaultCooldown,
+		newPicker: func() consistenthash.Picker {
+			return consistenthash.New(defaultReplicas, nil)
+		},
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	if p.tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = p.tlsConfig
+		p.transport = transport
+	}
+	return p
 }
 
 // Log server name info
@@ -95,8 +467,22 @@ func (p *HTTPPool) Log(format string, v ...interface{}) {
 
 // ServeHTTP handle all http request
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := p.authorize(w, r); err != nil {
+		p.Log("[ServeHTTP] reject %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+		code := http.StatusUnauthorized
+		if !errors.Is(err, errUnauthorized) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, defaultStatsPath) {
+		p.serveStats(w, r)
+		return
+	}
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+		http.NotFound(w, r)
+		return
 	}
 	p.Log("%s %s", r.Method, r.URL.Path)
 	// /<basepath>/<groupname>/<key> required
@@ -114,14 +500,137 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	view, err := group.Get(key)
+	group.Stats.ServerRequests.Add(1)
+	// POST /<basepath>/<groupname>/ 的 body 为 protobuf 编码的 MultiRequest，一次获取多个 key
+	if r.Method == http.MethodPost && key == "" {
+		p.serveMulti(w, r, group)
+		return
+	}
+
+	// 其余请求的 body 均为 protobuf 编码的 Request
+	in, err := readRequest(r, groupName, key)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, "bad request: " + err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 节点间的 DELETE 请求只删除本地缓存，不再转发，避免节点间循环删除。
+	// Request.forward 为 true 时则通过 Group.Remove 删除所属节点与其余节点上的值，供管理工具使用
+	if r.Method == http.MethodDelete {
+		if in.GetForward() {
+			if err := group.Remove(key); err != nil {
+				p.writeResponse(w, &pb.Response{Error: err.Error()}, http.StatusInternalServerError)
+				return
+			}
+			p.writeResponse(w, &pb.Response{}, http.StatusOK)
+			return
+		}
+		group.removeLocally(key)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// PUT 请求只写入本地，不再转发；副本写入只更新缓存。
+	// POST /<basepath>/<groupname>/<key> 则通过 Group.Set 写入，由本节点转发给所属节点并更新副本，
+	// 供管理工具等不了解节点配置的客户端使用
+	if r.Method == http.MethodPut || r.Method == http.MethodPost {
+		if r.Method == http.MethodPost {
+			err = group.Set(key, in.GetValue())
+		} else {
+			err = group.setFromPeer(key, in)
+		}
+		if err != nil {
+			p.writeResponse(w, &pb.Response{Error: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		p.writeResponse(w, &pb.Response{}, http.StatusOK)
+		return
+	}
+
+	view, err := group.GetContext(r.Context(), key)
+	if IsNotFound(err) {
+		p.writeResponse(w, &pb.Response{Error: err.Error(), NotFound: true}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		p.writeResponse(w, &pb.Response{Error: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	p.writeResponse(w, &pb.Response{Value: view.ByteSlice()}, http.StatusOK)
+}
+
+// readRequest 解码 body 中的 Request，body 中的 group 与 key 需与路径相同。
+// body 为空时（例如直接用 curl 访问）由路径中的 group 与 key 构造
+func readRequest(r *http.Request, group, key string) (*pb.Request, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return &pb.Request{Group: group, Key: key}, nil
+	}
+	in := &pb.Request{}
+	if err := proto.Unmarshal(body, in); err != nil {
+		return nil, err
+	}
+	if in.GetGroup() != group || in.GetKey() != key {
+		return nil, fmt.Errorf("request for %s/%s sent to %s/%s", in.GetGroup(), in.GetKey(), group, key)
+	}
+	return in, nil
+}
+
+// serveMulti 处理批量获取请求，每个 key 的结果按顺序放在 MultiResponse 中
+func (p *HTTPPool) serveMulti(w http.ResponseWriter, r *http.Request, group *Group) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	in := &pb.MultiRequest{}
+	if err := proto.Unmarshal(body, in); err != nil {
+		http.Error(w, "bad request: " + err.Error(), http.StatusBadRequest)
+		return
+	}
+	vals, errs := group.getMulti(r.Context(), in.GetKeys())
+	p.writeResponse(w, multiResponse(in.GetKeys(), vals, errs), http.StatusOK)
+}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Write(view.ByteSlice())
+// writeResponse 将 Response 编码为 protobuf 后写回
+func (p *HTTPPool) writeResponse(w http.ResponseWriter, res proto.Message, code int) {
+	body, err := proto.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", protobufContentType)
+	w.WriteHeader(code)
+	w.Write(body)
 }
 
+// serveStats 处理 /<statspath>/ 与 /<statspath>/<groupname> 请求，前者返回所有 group 的统计信息
+func (p *HTTPPool) serveStats(w http.ResponseWriter, r *http.Request) {
+	groupName := r.URL.Path[len(defaultStatsPath):]
+	var body interface{}
+	if groupName == "" {
+		stats := make(map[string]GroupStats)
+		mu.RLock()
+		for name, g := range groups {
+			stats[name] = g.StatsSnapshot()
+		}
+		mu.RUnlock()
+		body = stats
+	} else {
+		group := GetGroup(groupName)
+		if group == nil {
+			http.Error(w, "no such group:" + groupName, http.StatusNotFound)
+			return
+		}
+		body = group.StatsSnapshot()
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		p.Log("[serveStats] encode stats error: %v", err)
+	}
+}
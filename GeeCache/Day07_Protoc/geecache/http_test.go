@@ -0,0 +1,367 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestServeStats(t *testing.T) {
+	group := NewGroup("stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	for i := 0; i < 4; i++ {
+		group.Get("Tom")
+	}
+
+	pool := NewHTTPPool("http://localhost:8001")
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultStatsPath+"stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	var stats GroupStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode stats failed: %v", err)
+	}
+	if stats.Gets != 4 || stats.CacheHits != 3 || stats.LocalLoads != 1 ||
+		stats.HitRatio != 0.75 || stats.MainCache.Items != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	w = httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultStatsPath+"unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown group should return 404, got %d", w.Code)
+	}
+}
+
+func TestHTTPGetter(t *testing.T) {
+	NewGroup("proto", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	pool := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+
+	getter := pool.newGetter(server.URL)
+	res := &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: "proto", Key: "Tom"}, res); err != nil || string(res.Value) != db["Tom"] {
+		t.Fatalf("failed to get Tom from peer: %v, value: %q", err, res.Value)
+	}
+
+	res = &pb.Response{}
+	err := getter.Get(&pb.Request{Group: "proto", Key: "unknown"}, res)
+	if err == nil || err.Error() != "unknown not exist" {
+		t.Fatalf("peer error should be carried in Response, got %v", err)
+	}
+	// GET 的 body 同样是 protobuf 编码的 Request，与路径不一致时拒绝；没有 body 时使用路径
+	body, _ := proto.Marshal(&pb.Request{Group: "proto", Key: "Jack"})
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultBasePath+"proto/Tom", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("mismatched body should return 400, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultBasePath+"proto/Tom", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("get without body should use the path, got %d", w.Code)
+	}
+}
+
+func TestPickPeerFailover(t *testing.T) {
+	NewGroup("failover", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	alive := httptest.NewServer(NewHTTPPool("alive"))
+	defer alive.Close()
+	down := httptest.NewServer(NewHTTPPool("down"))
+	downURL := down.URL
+	down.Close()
+
+	pool := NewHTTPPool("http://localhost:8001",
+		WithPeerTimeout(time.Second), WithCircuitBreaker(2, 50*time.Millisecond))
+	pool.Set(alive.URL, downURL)
+
+	// 找到一个属于宕机节点的 key
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key%d", i); pool.peers.Get(k) == downURL {
+			key = k
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		peer, ok := pool.PickPeer(key)
+		if !ok || peer.(*httpGetter).baseURL != downURL+defaultBasePath {
+			t.Fatalf("should pick the owner before it is marked unhealthy")
+		}
+		if err := peer.Get(&pb.Request{Group: "failover", Key: key}, &pb.Response{}); err == nil {
+			t.Fatal("get from down peer should fail")
+		}
+	}
+
+	peer, ok := pool.PickPeer(key)
+	if !ok || peer.(*httpGetter).baseURL != alive.URL+defaultBasePath {
+		t.Fatal("should fail over to the next healthy peer")
+	}
+	if pool.Healthy()[downURL] {
+		t.Fatal("down peer should be reported unhealthy")
+	}
+
+	// 冷却结束后放行探测请求，成功后节点恢复
+	time.Sleep(60 * time.Millisecond)
+	peer, ok = pool.PickPeer(key)
+	if !ok || peer.(*httpGetter).baseURL != downURL+defaultBasePath {
+		t.Fatal("should probe the owner after cooldown")
+	}
+	peer.(*httpGetter).health.success()
+	if !pool.Healthy()[downURL] {
+		t.Fatal("peer should be healthy after a successful probe")
+	}
+}
+
+func TestWithPicker(t *testing.T) {
+	peers := []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"}
+	for name, newPicker := range map[string]func() consistenthash.Picker{
+		"bounded":    func() consistenthash.Picker { return consistenthash.NewBounded(defaultReplicas, 0.25, nil) },
+		"jump":       func() consistenthash.Picker { return consistenthash.NewJump(nil) },
+		"rendezvous": func() consistenthash.Picker { return consistenthash.NewRendezvous(nil) },
+	} {
+		pool := NewHTTPPool("http://localhost:8001", WithPicker(newPicker))
+		pool.Set(peers...)
+		for _, key := range []string{"Tom", "Jack", "Sam"} {
+			owner := pool.peers.Get(key)
+			peer, ok := pool.PickPeer(key)
+			if ok != (owner != pool.self) || (ok && peer.(*httpGetter).peer != owner) {
+				t.Fatalf("%s: %s should be picked from its owner %s", name, key, owner)
+			}
+		}
+		if _, ok := pool.peers.(loadTracker); ok != (name == "bounded") {
+			t.Fatalf("%s: only bounded picker should track loads", name)
+		}
+	}
+	// Bounded 按本地负载选择读取的节点，写入与删除仍落在不考虑负载的哈希环上的所属节点
+	pool := NewHTTPPool("http://localhost:8001", WithPicker(func() consistenthash.Picker {
+		return consistenthash.NewBounded(defaultReplicas, 0, nil)
+	}))
+	pool.Set(peers...)
+	ring := consistenthash.New(defaultReplicas, nil)
+	ring.Add(peers...)
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key%d", i); ring.Get(k) != pool.self {
+			key = k
+		}
+	}
+	owner := ring.Get(key)
+	for i := 0; i < 10; i++ {
+		pool.peers.(loadTracker).Inc(owner)
+	}
+	if peer, ok := pool.PickPeer(key); ok && peer.(*httpGetter).peer == owner {
+		t.Fatal("loaded owner should be skipped for reads")
+	}
+	if peer, ok := pool.PickOwner(key); !ok || peer.(*httpGetter).peer != owner {
+		t.Fatalf("writes should go to the ring owner %s", owner)
+	}
+}
+
+func TestHTTPSet(t *testing.T) {
+	group := NewGroup("http-set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	pool := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+
+	getter := pool.newGetter(server.URL)
+	if err := getter.Set(&pb.Request{Group: "http-set", Key: "Tom", Value: []byte("630")}); err != nil {
+		t.Fatalf("set over http failed: %v", err)
+	}
+	if view, err := group.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("value should be stored on the peer, got %q, %v", view.String(), err)
+	}
+
+	// POST 通过 Group.Set 写入，没有注册节点时写入本地的缓存与数据源
+	src := &mapSource{data: map[string]string{}}
+	forward := NewGroup("http-set-forward", 2<<10, src)
+	body, _ := proto.Marshal(&pb.Request{Group: "http-set-forward", Key: "Tom", Value: []byte("630")})
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodPost, defaultBasePath+"http-set-forward/Tom", bytes.NewReader(body)))
+	if view, ok := forward.mainCache.get("Tom"); w.Code != http.StatusOK || !ok || view.String() != "630" || src.data["Tom"] != "630" {
+		t.Fatalf("post should write through Group.Set, got %d, %q / %v", w.Code, view.String(), src.data)
+	}
+
+	// 副本写入只更新缓存，不写入数据源
+	src = &mapSource{data: map[string]string{}}
+	replica := NewGroup("http-set-replica", 2<<10, src)
+	if err := getter.Set(&pb.Request{Group: "http-set-replica", Key: "Tom", Value: []byte("630"), Replica: true}); err != nil {
+		t.Fatalf("replica set over http failed: %v", err)
+	}
+	if view, ok := replica.mainCache.get("Tom"); !ok || view.String() != "630" || len(src.data) != 0 {
+		t.Fatalf("replica write should only update the cache, got %q / %v", view.String(), src.data)
+	}
+}
+
+func TestHTTPNotFound(t *testing.T) {
+	NewGroup("http-not-found", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, &NotFoundError{Key: key}
+		}))
+	pool := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultBasePath+"http-not-found/k", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("missing key should return 404, got %d", w.Code)
+	}
+
+	getter := pool.newGetter(server.URL)
+	err := getter.Get(&pb.Request{Group: "http-not-found", Key: "k"}, &pb.Response{})
+	if !IsNotFound(err) {
+		t.Fatalf("expected NotFoundError, got %v", err)
+	}
+	if !getter.health.healthy() {
+		t.Fatal("404 should not mark the peer unhealthy")
+	}
+
+	// 节点上没有该 group 等其他 404 不是 key 不存在，而是节点出错
+	getter = NewHTTPPool("http://localhost:8002", WithCircuitBreaker(1, time.Minute)).newGetter(server.URL)
+	err = getter.Get(&pb.Request{Group: "no-such-group", Key: "k"}, &pb.Response{})
+	if err == nil || IsNotFound(err) {
+		t.Fatalf("missing group should be a peer error, got %v", err)
+	}
+	if getter.health.healthy() {
+		t.Fatal("missing group should count as a peer failure")
+	}
+}
+
+func TestReplication(t *testing.T) {
+	NewGroup("replication", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	alive := httptest.NewServer(NewHTTPPool("alive"))
+	defer alive.Close()
+	down := httptest.NewServer(NewHTTPPool("down"))
+	downURL := down.URL
+	down.Close()
+
+	pool := NewHTTPPool("http://localhost:8001", WithPeerTimeout(time.Second), WithReplication(2, true))
+	pool.Set(alive.URL, downURL)
+
+	// 找到一个第一个副本为宕机节点的 key
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key%d", i); pool.peers.Get(k) == downURL {
+			key = k
+		}
+	}
+
+	peer, ok := pool.PickPeer(key)
+	if !ok {
+		t.Fatal("should pick the replicas")
+	}
+	if _, ok := peer.(*replicaGetter); !ok {
+		t.Fatalf("expect a replicaGetter, got %T", peer)
+	}
+	res := &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: "replication", Key: key}, res); err != nil || string(res.Value) != key {
+		t.Fatalf("should fall back to the second replica, got %q, %v", res.Value, err)
+	}
+	if again, _ := pool.PickPeer(key); again != peer {
+		t.Fatal("keys with the same replicas should share a replicaGetter")
+	}
+
+	// 写入扇出到所有副本，宕机的副本返回错误，存活的副本仍被写入
+	if err := peer.Set(&pb.Request{Group: "replication", Key: key, Value: []byte("v")}); err == nil {
+		t.Fatal("set on the down replica should fail")
+	}
+	if v, ok := GetGroup("replication").mainCache.get(key); !ok || v.String() != "v" {
+		t.Fatalf("alive replica should be written, got %q", v.String())
+	}
+
+	// 自己是副本之一时由本地加载，Set 时写入其余副本
+	self := NewHTTPPool("http://localhost:8001", WithReplication(2, true))
+	self.Set("http://localhost:8001", alive.URL)
+	if _, ok := self.PickPeer(key); ok {
+		t.Fatal("every key is replicated on self")
+	}
+	replicas := self.PickReplicas(key)
+	if len(replicas) != 1 || replicas[0].(*httpGetter).baseURL != alive.URL+defaultBasePath {
+		t.Fatalf("unexpected replicas: %v", replicas)
+	}
+}
+
+func TestProbeCancelled(t *testing.T) {
+	NewGroup("probe", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	release := make(chan struct{})
+	defer close(release)
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 读完 body 后服务端才能发现客户端断开连接，r.Context() 才会结束
+		ioutil.ReadAll(r.Body)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hung.Close()
+
+	pool := NewHTTPPool("http://localhost:8001", WithCircuitBreaker(1, 10*time.Millisecond))
+	pool.Set(hung.URL)
+	peer, ok := pool.PickPeer("Tom")
+	if !ok {
+		t.Fatal("should pick the only peer")
+	}
+	getter := peer.(*httpGetter)
+
+	// ctx 超时说明节点没有及时响应，记为失败并熔断
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := getter.GetContext(ctx, &pb.Request{Group: "probe", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatal("get from hung peer should time out")
+	}
+	if pool.Healthy()[hung.URL] {
+		t.Fatal("a timed out request should trip the breaker")
+	}
+
+	// 冷却结束后放行的探测请求被调用方取消，节点不能一直停留在半开状态
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := pool.PickPeer("Tom"); !ok {
+		t.Fatal("should probe the peer after cooldown")
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := getter.GetContext(ctx, &pb.Request{Group: "probe", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatal("cancelled probe should fail")
+	}
+	if _, ok := pool.PickPeer("Tom"); !ok {
+		t.Fatal("an abandoned probe should let the next request probe again")
+	}
+}
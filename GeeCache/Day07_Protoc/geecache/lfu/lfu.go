@@ -0,0 +1,200 @@
+package lfu
+
+import (
+	"container/list"
+	"sort"
+	"time"
+
+	"geecache/lru"
+)
+
+// Value 与 lru.Value 相同，使得各淘汰策略可以实现同一个接口
+type Value = lru.Value
+
+// Cache 是 LFU(Least Frequently Used) 缓存，淘汰访问次数最少的元素，
+// 访问次数相同时淘汰其中最久未被访问的元素。
+type Cache struct {
+	maxBytes	int64		// 允许使用最大内存
+	usedBytes	int64		// 已经使用的内存
+	cache		map[string]*list.Element
+	freqs		map[int]*list.List	// 访问次数 -> 该次数下的元素链表，队首为最新的
+	minFreq		int			// 当前最小的访问次数
+	OnEvicted	func(key string, value Value)	//	如果回调函数 OnEvicted 不为 nil，则调用回调函数。
+}
+
+type entry struct {
+	key		string
+	value	Value
+	freq	int			// 访问次数
+	expire	time.Time	// 过期时间，零值表示永不过期
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// now 便于测试时替换时间源
+var now = time.Now
+
+// New 实例化
+func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*list.Element),
+		freqs:     make(map[int]*list.List),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Get 查找 key，命中时访问次数加一
+func (c *Cache) Get(key string) (val Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		if kv.expired(now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		c.increment(ele)
+		return kv.value, true
+	}
+	return
+}
+
+// Add : add or modify
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 与 Add 相同，但会为 key 设置过期时间，expire 为零值时表示永不过期
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.usedBytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+		kv.expire = expire
+		c.increment(ele)
+	} else {
+		kv := &entry{key: key, value: value, freq: 1, expire: expire}
+		c.cache[key] = c.list(1).PushFront(kv)
+		c.minFreq = 1
+		c.usedBytes += int64(value.Len()) + int64(len(key))
+	}
+	for c.maxBytes != 0 && c.usedBytes > c.maxBytes {
+		c.RemoveOldest()
+	}
+}
+
+// SetMaxBytes 修改允许使用的最大内存，缩小时立即淘汰多出的元素，0 表示不限制
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	for c.maxBytes != 0 && c.usedBytes > c.maxBytes {
+		c.RemoveOldest()
+	}
+}
+
+// RemoveOldest 淘汰访问次数最少的元素
+func (c *Cache) RemoveOldest() {
+	if len(c.cache) == 0 {
+		return
+	}
+	l, ok := c.freqs[c.minFreq]
+	if !ok {
+		// 删除或过期可能使 minFreq 对应的链表被清空，此时重新计算
+		c.minFreq = 0
+		for freq := range c.freqs {
+			if c.minFreq == 0 || freq < c.minFreq {
+				c.minFreq = freq
+			}
+		}
+		l = c.freqs[c.minFreq]
+	}
+	c.removeElement(l.Back())
+}
+
+// Remove 删除指定 key，返回 key 是否存在
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired 删除所有已过期的元素，返回删除的个数
+func (c *Cache) RemoveExpired() int {
+	cur := now()
+	removed := 0
+	for _, ele := range c.cache {
+		if ele.Value.(*entry).expired(cur) {
+			c.removeElement(ele)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Walk 按访问次数从少到多遍历所有元素，访问次数相同时从最久未访问的开始。
+// 遍历过程中不能修改 Cache
+func (c *Cache) Walk(fn func(key string, value Value, expire time.Time)) {
+	freqs := make([]int, 0, len(c.freqs))
+	for freq := range c.freqs {
+		freqs = append(freqs, freq)
+	}
+	sort.Ints(freqs)
+	for _, freq := range freqs {
+		for ele := c.freqs[freq].Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			fn(kv.key, kv.value, kv.expire)
+		}
+	}
+}
+
+// Bytes 返回当前已经使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.usedBytes
+}
+
+// Len 返回元素个数
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+func (c *Cache) list(freq int) *list.List {
+	l, ok := c.freqs[freq]
+	if !ok {
+		l = list.New()
+		c.freqs[freq] = l
+	}
+	return l
+}
+
+// increment 将元素移动到访问次数加一后的链表中
+func (c *Cache) increment(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.unlink(ele)
+	if _, ok := c.freqs[kv.freq]; !ok && c.minFreq == kv.freq {
+		c.minFreq++
+	}
+	kv.freq++
+	c.cache[kv.key] = c.list(kv.freq).PushFront(kv)
+}
+
+// unlink 将元素从所在的访问次数链表中移除，链表为空时一并删除
+func (c *Cache) unlink(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	l := c.freqs[kv.freq]
+	l.Remove(ele)
+	if l.Len() == 0 {
+		delete(c.freqs, kv.freq)
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	c.unlink(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.usedBytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
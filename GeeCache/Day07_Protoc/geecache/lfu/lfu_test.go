@@ -0,0 +1,66 @@
+package lfu
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestRemoveOldest(t *testing.T) {
+	evicted := make([]string, 0)
+	// 每个元素占用 4 字节，最多容纳 3 个
+	lfu := New(int64(12), func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	lfu.Add("k3", String("v3"))
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Get("k3")
+
+	// k2 只被访问过一次，最先淘汰；之后 k4 与 k3 中 k4 访问次数最少
+	lfu.Add("k4", String("v4"))
+	lfu.Add("k5", String("v5"))
+
+	if expect := []string{"k2", "k4"}; !reflect.DeepEqual(expect, evicted) {
+		t.Fatalf("evicted keys %v, expect %v", evicted, expect)
+	}
+	if _, ok := lfu.Get("k1"); !ok || lfu.Len() != 3 || lfu.Bytes() != 12 {
+		t.Fatalf("k1 should stay, len: %d, bytes: %d", lfu.Len(), lfu.Bytes())
+	}
+}
+
+func TestRemoveAndExpire(t *testing.T) {
+	cur := time.Now()
+	now = func() time.Time { return cur }
+	defer func() { now = time.Now }()
+
+	lfu := New(int64(12), nil)
+	lfu.AddWithExpire("k1", String("v1"), cur.Add(time.Second))
+	lfu.Add("k2", String("v2"))
+	lfu.Get("k2")
+	if !lfu.Remove("k2") || lfu.Len() != 1 {
+		t.Fatalf("remove k2 failed, len: %d", lfu.Len())
+	}
+
+	cur = cur.Add(time.Minute)
+	if n := lfu.RemoveExpired(); n != 1 || lfu.Bytes() != 0 {
+		t.Fatalf("RemoveExpired removed %d, bytes: %d", n, lfu.Bytes())
+	}
+	// 删除后 minFreq 对应的链表可能已不存在，仍需要能正常淘汰
+	lfu.Add("k3", String("v3"))
+	lfu.Get("k3")
+	lfu.Add("k4", String("v4"))
+	lfu.Add("k5", String("v5"))
+	lfu.Add("k6", String("v6"))
+	if _, ok := lfu.Get("k3"); !ok || lfu.Len() != 3 {
+		t.Fatalf("k3 should stay, len: %d", lfu.Len())
+	}
+}
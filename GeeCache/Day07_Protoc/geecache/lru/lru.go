@@ -1,6 +1,9 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"time"
+)
 
 type Cache struct {
 	maxBytes	int64		// 允许使用最大内存
@@ -13,8 +16,17 @@ type Cache struct {
 type entry struct {
 	key		string
 	value 	Value
+	expire	time.Time	// 过期时间，零值表示永不过期
 }
 
+// expired 判断 entry 在 now 时刻是否已经过期
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// now 便于测试时替换时间源
+var now = time.Now
+
 // Value use Len to count how many bytes it takes
 type Value interface {
 	Len()	int
@@ -34,8 +46,13 @@ func New(maxBytes int64, OnEvicted func(key string, value Value)) *Cache {
 func (c *Cache) Get(key string) (val Value, ok bool) {
 	// 如果存在，就取出，并移到队首
 	if ele, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
+		// 惰性过期：访问时发现已过期则直接删除，视为未命中
+		if kv.expired(now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		c.ll.MoveToFront(ele)
 		return kv.value, true
 	}
 	return
@@ -45,18 +62,51 @@ func (c *Cache) Get(key string) (val Value, ok bool) {
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)	// ll 中移除
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)	// map 中删除
-		c.usedBytes -= int64(len(kv.key)) + int64(kv.value.Len())	// 使用内存去除
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)	// 如果回调函数 OnEvicted 不为 nil，则调用回调函数。
+		c.removeElement(ele)
+	}
+}
+
+// Remove 删除指定 key，返回 key 是否存在
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired 遍历整个链表，删除所有已过期的元素，返回删除的个数。供后台清理协程定期调用
+func (c *Cache) RemoveExpired() int {
+	cur := now()
+	removed := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry).expired(cur) {
+			c.removeElement(ele)
+			removed++
 		}
+		ele = prev
+	}
+	return removed
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)	// ll 中移除
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)	// map 中删除
+	c.usedBytes -= int64(len(kv.key)) + int64(kv.value.Len())	// 使用内存去除
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)	// 如果回调函数 OnEvicted 不为 nil，则调用回调函数。
 	}
 }
 
 // Add : add or modify
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 与 Add 相同，但会为 key 设置过期时间，expire 为零值时表示永不过期
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
 	// 判断是否存在
 	if element, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(element)
@@ -64,10 +114,12 @@ func (c *Cache) Add(key string, value Value) {
 		// 由于 val 值可能更新，因此需要更新使用内存
 		c.usedBytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
+		kv.expire = expire
 	} else {
 		element := c.ll.PushFront(&entry{
-			key:   key,
-			value: value,
+			key:    key,
+			value:  value,
+			expire: expire,
 		})
 		c.cache[key] = element
 		c.usedBytes += int64(value.Len()) + int64(len(key))
@@ -78,6 +130,28 @@ func (c *Cache) Add(key string, value Value) {
 	}
 }
 
+// SetMaxBytes 修改允许使用的最大内存，缩小时立即淘汰多出的元素，0 表示不限制
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	for c.maxBytes != 0 && c.usedBytes > c.maxBytes {
+		c.RemoveOldest()
+	}
+}
+
+// Walk 从最久未访问到最近访问依次遍历所有元素，按遍历顺序重新 Add 可以还原原来的 LRU 顺序。
+// 遍历过程中不能修改 Cache
+func (c *Cache) Walk(fn func(key string, value Value, expire time.Time)) {
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		fn(kv.key, kv.value, kv.expire)
+	}
+}
+
+// Bytes 返回当前已经使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.usedBytes
+}
+
 // Len ：为了方便测试，我们实现 Len() 用来获取添加了多少条数据
 func (c *Cache) Len() int {
 	return c.ll.Len()
@@ -3,6 +3,7 @@ package lru
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -66,4 +67,80 @@ func TestOnEvicted(t *testing.T) {
 	if !reflect.DeepEqual(expect, keys) {
 		t.Fatalf("Call OnEvicted failed, expect keys:%s equals to %s", keys, expect)
 	}
-}
\ No newline at end of file
+}
+func TestExpire(t *testing.T) {
+	cur := time.Now()
+	now = func() time.Time { return cur }
+	defer func() { now = time.Now }()
+
+	lru := New(int64(0), nil)
+	lru.AddWithExpire("key1", String("1234"), cur.Add(time.Second))
+	lru.AddWithExpire("key2", String("5678"), cur.Add(time.Minute))
+	lru.Add("key3", String("9012"))
+
+	if _, ok := lru.Get("key1"); !ok {
+		t.Fatal("key1 should not expire yet")
+	}
+
+	cur = cur.Add(2 * time.Second)
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 2 {
+		t.Fatalf("key1 should be lazily expired, len: %d", lru.Len())
+	}
+
+	cur = cur.Add(time.Hour)
+	if n := lru.RemoveExpired(); n != 1 || lru.Len() != 1 {
+		t.Fatalf("RemoveExpired removed %d keys, len: %d", n, lru.Len())
+	}
+	if _, ok := lru.Get("key3"); !ok {
+		t.Fatal("key3 without expire should never expire")
+	}
+	if lru.usedBytes != int64(len("key3")+len("9012")) {
+		t.Fatalf("usedBytes not updated after expire: %d", lru.usedBytes)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"))
+	if !lru.Remove("key1") || lru.Len() != 0 || lru.usedBytes != 0 {
+		t.Fatalf("remove key1 failed, len: %d, usedBytes: %d", lru.Len(), lru.usedBytes)
+	}
+	if lru.Remove("key1") {
+		t.Fatal("remove missing key1 should return false")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+	lru.Get("k1")
+
+	var keys []string
+	lru.Walk(func(key string, value Value, expire time.Time) {
+		keys = append(keys, key)
+	})
+	if expect := []string{"k2", "k3", "k1"}; !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("Walk order = %v, expect %v", keys, expect)
+	}
+}
+
+func TestSetMaxBytes(t *testing.T) {
+	var evicted []string
+	lru := New(int64(0), func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	for _, k := range []string{"k1", "k2", "k3"} {
+		lru.Add(k, String("v"+k[1:]))
+	}
+	lru.SetMaxBytes(8)
+	if lru.Len() != 2 || !reflect.DeepEqual(evicted, []string{"k1"}) {
+		t.Fatalf("shrinking should evict k1, len %d, evicted %v", lru.Len(), evicted)
+	}
+	lru.SetMaxBytes(0)
+	lru.Add("k4", String("v4"))
+	if lru.Len() != 3 {
+		t.Fatalf("0 should mean unlimited, len %d", lru.Len())
+	}
+}
@@ -0,0 +1,144 @@
+package geecache
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PeerSource 提供集群当前的节点列表，节点加入或离开后再次调用 Peers 可以得到新的列表
+type PeerSource interface {
+	Peers() ([]string, error)
+}
+
+// StaticPeers 是固定不变的节点列表
+type StaticPeers []string
+
+func (s StaticPeers) Peers() ([]string, error) {
+	return s, nil
+}
+
+// FilePeers 从文件中读取节点列表，每行一个节点地址，忽略空行和以 # 开头的注释。
+// 修改文件即可让运行中的节点感知到其他节点的加入与离开。
+type FilePeers string
+
+func (f FilePeers) Peers() ([]string, error) {
+	file, err := os.Open(string(f))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var peers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		peers = append(peers, line)
+	}
+	return peers, scanner.Err()
+}
+
+// MemberList 是 gossip 成员协议的简易替代：节点通过 Join/Leave 声明自己的加入与离开，
+// 所有共享同一个 MemberList 的节点都能看到最新的成员列表。
+type MemberList struct {
+	mu      sync.RWMutex
+	members map[string]bool
+}
+
+func NewMemberList(peers ...string) *MemberList {
+	m := &MemberList{members: make(map[string]bool)}
+	m.Join(peers...)
+	return m
+}
+
+// Join 加入节点
+func (m *MemberList) Join(peers ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, peer := range peers {
+		m.members[peer] = true
+	}
+}
+
+// Leave 移除节点
+func (m *MemberList) Leave(peers ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, peer := range peers {
+		delete(m.members, peer)
+	}
+}
+
+func (m *MemberList) Peers() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	peers := make([]string, 0, len(m.members))
+	for peer := range m.members {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers, nil
+}
+
+// WatchPeers 立即从 src 同步一次节点列表，之后每隔 interval 同步一次，返回的 stop 用于停止同步。
+// 读取失败时保留当前的节点列表。
+func (p *HTTPPool) WatchPeers(src PeerSource, interval time.Duration) (stop func()) {
+	return watchPeers(src, interval, p.SyncPeers)
+}
+
+// diffPeers 比较当前的节点列表 current 与新的节点列表 peers，返回新增与离开的节点
+func diffPeers(current, peers []string) (added, removed []string) {
+	want := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		want[peer] = true
+	}
+	for _, peer := range current {
+		if !want[peer] {
+			removed = append(removed, peer)
+		}
+		delete(want, peer)
+	}
+	for peer := range want {
+		added = append(added, peer)
+	}
+	return added, removed
+}
+
+// watchPeers 实现了 HTTPPool 与 RPCPool 的 WatchPeers，读取到的节点列表交给 apply 同步
+func watchPeers(src PeerSource, interval time.Duration, apply func(peers []string)) (stop func()) {
+	syncPeers := func() {
+		peers, err := src.Peers()
+		if err != nil {
+			log.Println("[WatchPeers] load peers error: ", err)
+			return
+		}
+		apply(peers)
+	}
+	syncPeers()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				syncPeers()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -0,0 +1,56 @@
+package geecache
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddRemovePeer(t *testing.T) {
+	pool := NewHTTPPool("http://localhost:8001")
+	if _, ok := pool.PickPeer("Tom"); ok {
+		t.Fatal("pool without peers should not pick any peer")
+	}
+
+	pool.AddPeer("http://localhost:8001", "http://localhost:8002")
+	pool.AddPeer("http://localhost:8002")
+	if peers := pool.Peers(); len(peers) != 2 {
+		t.Fatalf("unexpected peers: %v", peers)
+	}
+
+	pool.RemovePeer("http://localhost:8002")
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		if _, ok := pool.PickPeer(key); ok {
+			t.Fatalf("%s should belong to self after peer left", key)
+		}
+	}
+}
+
+func TestWatchPeers(t *testing.T) {
+	f, err := ioutil.TempFile("", "peers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# cache peers\nhttp://localhost:8001\n\nhttp://localhost:8002\n")
+	f.Close()
+
+	pool := NewHTTPPool("http://localhost:8001")
+	stop := pool.WatchPeers(FilePeers(f.Name()), time.Hour)
+	stop()
+	if expect := []string{"http://localhost:8001", "http://localhost:8002"}; !reflect.DeepEqual(pool.Peers(), expect) {
+		t.Fatalf("peers %v loaded from file, expect %v", pool.Peers(), expect)
+	}
+
+	members := NewMemberList("http://localhost:8001", "http://localhost:8002")
+	stop = pool.WatchPeers(members, 5*time.Millisecond)
+	defer stop()
+	members.Join("http://localhost:8003")
+	members.Leave("http://localhost:8002")
+	time.Sleep(30 * time.Millisecond)
+	if expect := []string{"http://localhost:8001", "http://localhost:8003"}; !reflect.DeepEqual(pool.Peers(), expect) {
+		t.Fatalf("peers %v after gossip update, expect %v", pool.Peers(), expect)
+	}
+}
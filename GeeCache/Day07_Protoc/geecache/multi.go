@@ -0,0 +1,324 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"geecache/singleflight"
+	"log"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// BatchGetter 是 Getter 的可选接口，GetMulti 未命中且属于本节点的 key 会通过它一次性从数据源加载。
+// 返回的 map 中不包含的 key 视为不存在，与 Getter 返回 NotFoundError 的处理相同。
+type BatchGetter interface {
+	GetMulti(keys []string) (map[string][]byte, error)
+}
+
+// ContextBatchTTLGetter 与 BatchGetter 相同，但加载时收到 context，并可以为每个 key 指定过期时间，
+// ttls 中不包含的 key 使用 Group 的默认过期时间。
+// Getter 实现了 TTLGetter 或 ContextTTLGetter 时，只有实现了该接口才会批量加载，否则逐个加载以保留每个 key 的过期时间
+type ContextBatchTTLGetter interface {
+	GetMultiWithTTLContext(ctx context.Context, keys []string) (values map[string][]byte, ttls map[string]time.Duration, err error)
+}
+
+// batchGetFunc 是统一了 BatchGetter 与 ContextBatchTTLGetter 的批量加载函数
+type batchGetFunc func(ctx context.Context, keys []string) (map[string][]byte, map[string]time.Duration, error)
+
+// GetMulti 一次获取多个 key，返回的 map 中只包含存在的 key
+func (g *Group) GetMulti(keys []string) (map[string]ByteView, error) {
+	return g.GetMultiContext(context.Background(), keys)
+}
+
+// GetMultiContext 与 GetMulti 相同，但会将 ctx 传递给远程节点与数据源。
+// 缓存未命中的 key 按所属节点分组，每个节点只发送一次批量请求，属于本节点的 key 优先通过 BatchGetter 或 ContextBatchTTLGetter 加载。
+// 部分 key 加载失败时仍返回其余 key 的值，error 为第一个失败的 key 的错误，不存在的 key 不视为错误。
+func (g *Group) GetMultiContext(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	vals, errs := g.getMulti(ctx, keys)
+	for _, key := range keys {
+		if err := errs[key]; err != nil && !IsNotFound(err) {
+			return vals, err
+		}
+	}
+	return vals, nil
+}
+
+// getMulti 返回每个 key 的值或错误，重复的 key 只会加载一次
+func (g *Group) getMulti(ctx context.Context, keys []string) (map[string]ByteView, map[string]error) {
+	var (
+		mu   sync.Mutex
+		vals = make(map[string]ByteView, len(keys))
+		errs = make(map[string]error)
+	)
+	collect := func(key string, v ByteView, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs[key] = err
+			return
+		}
+		vals[key] = v
+	}
+
+	seen := make(map[string]bool, len(keys))
+	var missing []string
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		g.Stats.Gets.Add(1)
+		if key == "" {
+			collect(key, ByteView{}, fmt.Errorf("key is empty"))
+			continue
+		}
+		if v, ok, err := g.lookupCache(key); ok {
+			collect(key, v, err)
+			continue
+		}
+		missing = append(missing, key)
+	}
+	if len(missing) == 0 {
+		return vals, errs
+	}
+	g.Stats.Loads.Add(int64(len(missing)))
+
+	// 按所属节点分组
+	byPeer := make(map[PeerGetter][]string)
+	var local []string
+	peers := g.peerPicker()
+	for _, key := range missing {
+		if peers != nil {
+			if peer, ok := peers.PickPeer(key); ok {
+				byPeer[peer] = append(byPeer[peer], key)
+				continue
+			}
+		}
+		local = append(local, key)
+	}
+
+	var wg sync.WaitGroup
+	for peer, peerKeys := range byPeer {
+		wg.Add(1)
+		go func(peer PeerGetter, peerKeys []string) {
+			defer wg.Done()
+			g.getMultiFromPeer(ctx, peer, peerKeys, collect)
+		}(peer, peerKeys)
+	}
+	if len(local) > 0 {
+		g.getMultiLocally(ctx, local, collect)
+	}
+	wg.Wait()
+	return vals, errs
+}
+
+// getMultiFromPeer 向一个远程节点批量请求 keys，节点不支持批量请求时逐个加载
+func (g *Group) getMultiFromPeer(ctx context.Context, peer PeerGetter, keys []string,
+	collect func(key string, v ByteView, err error)) {
+	bp, ok := peer.(BatchPeerGetter)
+	if !ok {
+		g.loadEach(ctx, keys, collect)
+		return
+	}
+
+	start := time.Now()
+	out := &pb.MultiResponse{}
+	err := bp.GetMulti(ctx, &pb.MultiRequest{Group: g.name, Keys: keys}, out)
+	if err == nil && len(out.GetResponses()) != len(keys) {
+		err = fmt.Errorf("peer returned %d responses for %d keys", len(out.GetResponses()), len(keys))
+	}
+	if err != nil {
+		// 与 load 相同，远程节点失败时从本地加载
+		g.Stats.PeerErrors.Add(1)
+		for _, key := range keys {
+			g.onPeerError(key, err)
+		}
+		log.Println("[getMultiFromPeer] peer batch get failed! err: ", err)
+		g.getMultiLocally(ctx, keys, collect)
+		return
+	}
+
+	var failed []string
+	for i, res := range out.GetResponses() {
+		key := keys[i]
+		switch {
+		case res.GetNotFound():
+			g.Stats.PeerLoads.Add(1)
+			err := &NotFoundError{Key: key}
+			g.onLoad(key, LoadFromPeer, err, start)
+			collect(key, ByteView{}, err)
+		case res.GetError() != "":
+			g.Stats.PeerErrors.Add(1)
+			err := errors.New(res.GetError())
+			g.onPeerError(key, err)
+			failed = append(failed, key)
+		default:
+			g.Stats.PeerLoads.Add(1)
+			g.onLoad(key, LoadFromPeer, nil, start)
+			val := ByteView{b: res.GetValue()}
+			if g.hotCacheEnabled() && rand.Intn(g.hotSampleRate) == 0 {
+				g.addToHotCache(key, val)
+			}
+			collect(key, val, nil)
+		}
+	}
+	// 与 load 相同，远程节点加载某个 key 失败时从本地加载
+	if len(failed) > 0 {
+		log.Printf("[getMultiFromPeer] peer failed to load %d keys, loading locally", len(failed))
+		g.getMultiLocally(ctx, failed, collect)
+	}
+}
+
+// batchGetter 返回从数据源批量加载的函数，Getter 不支持批量加载或批量加载会丢失每个 key 的过期时间时返回 nil
+func (g *Group) batchGetter() batchGetFunc {
+	switch getter := g.getter.(type) {
+	case ContextBatchTTLGetter:
+		return getter.GetMultiWithTTLContext
+	case TTLGetter, ContextTTLGetter:
+		return nil
+	case BatchGetter:
+		return func(ctx context.Context, keys []string) (map[string][]byte, map[string]time.Duration, error) {
+			values, err := getter.GetMulti(keys)
+			return values, nil, err
+		}
+	default:
+		return nil
+	}
+}
+
+// batchLoad 是一次批量加载的结果，done 关闭后 vals 与 errs 不再改变
+type batchLoad struct {
+	done chan struct{}
+	vals map[string]ByteView
+	errs map[string]error
+}
+
+// getMultiLocally 一次性从数据源加载 keys，Getter 不支持批量加载时逐个加载。
+// 与 load 相同，每个 key 都经过 singleflight：已经在加载中的 key 共享那次加载的结果，其余的 key 由一次批量加载完成
+func (g *Group) getMultiLocally(ctx context.Context, keys []string,
+	collect func(key string, v ByteView, err error)) {
+	getMulti := g.batchGetter()
+	if getMulti == nil {
+		g.loadEach(ctx, keys, collect)
+		return
+	}
+
+	b := &batchLoad{done: make(chan struct{})}
+	var (
+		batch   []string
+		results = make(map[string]<-chan singleflight.Result, len(keys))
+		leaders = make(map[string]bool, len(keys))
+	)
+	for _, key := range keys {
+		key := key
+		results[key], leaders[key] = g.loader.DoChanLeader(key, func() (interface{}, error) {
+			<-b.done
+			if err := b.errs[key]; err != nil {
+				return nil, err
+			}
+			return loaded{val: b.vals[key], src: LoadFromGetter}, nil
+		})
+		if leaders[key] {
+			batch = append(batch, key)
+		}
+	}
+	// 与 load 相同，共享的加载不随调用方的 ctx 一起被取消，调用方可以放弃等待
+	go func() {
+		defer close(b.done)
+		loadCtx, cancel := g.loadContext(ctx)
+		defer cancel()
+		g.loadBatch(loadCtx, getMulti, batch, b)
+	}()
+
+	for _, key := range keys {
+		select {
+		case res := <-results[key]:
+			if !leaders[key] {
+				g.Stats.LoadsDeduped.Add(1)
+			}
+			if res.Err != nil {
+				collect(key, ByteView{}, res.Err)
+				continue
+			}
+			collect(key, res.Val.(loaded).val, nil)
+		case <-ctx.Done():
+			collect(key, ByteView{}, ctx.Err())
+		}
+	}
+}
+
+// loadBatch 通过 getMulti 加载 keys，将每个 key 的结果写入 b 并加入缓存。getMulti 发生 panic 时所有 key 都得到 PanicError
+func (g *Group) loadBatch(ctx context.Context, getMulti batchGetFunc, keys []string, b *batchLoad) {
+	b.vals = make(map[string]ByteView, len(keys))
+	b.errs = make(map[string]error)
+	if len(keys) == 0 {
+		return
+	}
+	start := time.Now()
+	fail := func(err error) {
+		g.Stats.LocalLoadErrs.Add(int64(len(keys)))
+		for _, key := range keys {
+			g.onLoad(key, LoadFromGetter, err, start)
+			b.errs[key] = err
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			fail(&singleflight.PanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+
+	values, ttls, err := getMulti(ctx, keys)
+	if err != nil {
+		fail(err)
+		return
+	}
+	for _, key := range keys {
+		v, ok := values[key]
+		if !ok {
+			g.Stats.LocalLoadErrs.Add(1)
+			g.addMiss(key)
+			err := &NotFoundError{Key: key}
+			g.onLoad(key, LoadFromGetter, err, start)
+			b.errs[key] = err
+			continue
+		}
+		g.Stats.LocalLoads.Add(1)
+		g.onLoad(key, LoadFromGetter, nil, start)
+		val := ByteView{b: cloneBytes(v)}
+		g.addToCache(key, val, ttls[key])
+		b.vals[key] = val
+	}
+}
+
+// loadEach 并发地逐个加载 keys，每个 key 仍经过 singleflight
+func (g *Group) loadEach(ctx context.Context, keys []string,
+	collect func(key string, v ByteView, err error)) {
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			v, err := g.loadOnce(ctx, key)
+			collect(key, v, err)
+		}(key)
+	}
+	wg.Wait()
+}
+
+// multiResponse 按 keys 的顺序将 getMulti 的结果转换为 MultiResponse
+func multiResponse(keys []string, vals map[string]ByteView, errs map[string]error) *pb.MultiResponse {
+	out := &pb.MultiResponse{Responses: make([]*pb.Response, len(keys))}
+	for i, key := range keys {
+		if err := errs[key]; err != nil {
+			out.Responses[i] = &pb.Response{Error: err.Error(), NotFound: IsNotFound(err)}
+			continue
+		}
+		out.Responses[i] = &pb.Response{Value: vals[key].ByteSlice()}
+	}
+	return out
+}
@@ -0,0 +1,236 @@
+package geecache
+
+import (
+	"context"
+	pb "geecache/geecachepb"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchSource 实现了 BatchGetter，记录批量加载的次数
+type batchSource struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (s *batchSource) Get(key string) ([]byte, error) {
+	return nil, &NotFoundError{Key: key}
+}
+
+func (s *batchSource) GetMulti(keys []string) (map[string][]byte, error) {
+	s.mu.Lock()
+	s.batches = append(s.batches, keys)
+	s.mu.Unlock()
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		if v, ok := db[key]; ok {
+			values[key] = []byte(v)
+		}
+	}
+	return values, nil
+}
+
+func TestGetMultiBatchGetter(t *testing.T) {
+	src := &batchSource{}
+	g := NewGroup("multi-local", 2<<10, src)
+
+	vals, err := g.GetMulti([]string{"Tom", "Jack", "unknown", "Tom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != 2 || vals["Tom"].String() != db["Tom"] || vals["Jack"].String() != db["Jack"] {
+		t.Fatalf("unexpected values: %v", vals)
+	}
+	if len(src.batches) != 1 || len(src.batches[0]) != 3 {
+		t.Fatalf("missing keys should be loaded in one batch, got %v", src.batches)
+	}
+
+	// 再次获取时全部命中缓存，不存在的 key 命中 missCache
+	if vals, _ := g.GetMulti([]string{"Tom", "Jack", "unknown"}); len(vals) != 2 || len(src.batches) != 1 {
+		t.Fatalf("second GetMulti should be served from cache, batches: %v", src.batches)
+	}
+}
+
+// ttlBatchSource 实现了 ContextBatchTTLGetter，Get 在 release 关闭前阻塞
+type ttlBatchSource struct {
+	started chan string   // Get 开始时写入 key
+	release chan struct{} // 关闭后 Get 返回
+	batched chan []string // 每次批量加载写入 keys
+	mu      sync.Mutex
+	ctxVals []interface{}
+}
+
+type batchCtxKey struct{}
+
+func (s *ttlBatchSource) Get(key string) ([]byte, error) {
+	s.started <- key
+	<-s.release
+	return []byte("get-" + key), nil
+}
+
+func (s *ttlBatchSource) GetMultiWithTTLContext(ctx context.Context, keys []string) (map[string][]byte, map[string]time.Duration, error) {
+	s.mu.Lock()
+	s.ctxVals = append(s.ctxVals, ctx.Value(batchCtxKey{}))
+	s.mu.Unlock()
+	s.batched <- keys
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		values[key] = []byte("batch-" + key)
+	}
+	return values, map[string]time.Duration{"short": 10 * time.Millisecond}, nil
+}
+
+func TestGetMultiBatchSingleflight(t *testing.T) {
+	src := &ttlBatchSource{
+		started: make(chan string, 1),
+		release: make(chan struct{}),
+		batched: make(chan []string, 2),
+	}
+	g := NewGroup("multi-dedup", 2<<10, src, WithTTL(time.Hour), WithSweepInterval(0))
+
+	got := make(chan ByteView)
+	go func() {
+		v, _ := g.Get("Tom")
+		got <- v
+	}()
+	<-src.started
+
+	// Tom 正在由 Get 加载，GetMulti 共享那次加载，只批量加载 short
+	ctx := context.WithValue(context.Background(), batchCtxKey{}, "v")
+	multi := make(chan map[string]ByteView)
+	go func() {
+		vals, _ := g.GetMultiContext(ctx, []string{"Tom", "short"})
+		multi <- vals
+	}()
+	if keys := <-src.batched; !reflect.DeepEqual(keys, []string{"short"}) {
+		t.Fatalf("only keys not being loaded should be batched, got %v", keys)
+	}
+	close(src.release)
+	vals := <-multi
+	if v := <-got; v.String() != "get-Tom" || vals["Tom"].String() != "get-Tom" || vals["short"].String() != "batch-short" {
+		t.Fatalf("GetMulti = %v, Get = %q", vals, v.String())
+	}
+	if n := g.Stats.LoadsDeduped.Get(); n != 1 {
+		t.Fatalf("LoadsDeduped = %d, want 1", n)
+	}
+	if src.ctxVals[0] != "v" {
+		t.Fatalf("batch getter should get the caller's ctx values, got %v", src.ctxVals)
+	}
+
+	// short 使用数据源指定的过期时间，过期后重新加载
+	time.Sleep(20 * time.Millisecond)
+	g.GetMulti([]string{"Tom", "short"})
+	select {
+	case keys := <-src.batched:
+		if !reflect.DeepEqual(keys, []string{"short"}) {
+			t.Fatalf("expired short should be reloaded alone, got %v", keys)
+		}
+	default:
+		t.Fatal("short should expire with its own ttl")
+	}
+}
+
+// fakeBatchPeer 在 fakePeer 的基础上支持批量请求
+type fakeBatchPeer struct {
+	fakePeer
+	batches int
+	errs    map[string]string // 在 Response.Error 中返回错误的 key
+}
+
+func (p *fakeBatchPeer) GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches++
+	for _, key := range in.GetKeys() {
+		if msg, ok := p.errs[key]; ok {
+			out.Responses = append(out.Responses, &pb.Response{Error: msg})
+		} else if v, ok := p.values[key]; ok {
+			out.Responses = append(out.Responses, &pb.Response{Value: []byte(v)})
+		} else {
+			out.Responses = append(out.Responses, &pb.Response{NotFound: true})
+		}
+	}
+	return nil
+}
+
+type batchPicker struct {
+	peer *fakeBatchPeer
+}
+
+func (b *batchPicker) PickPeer(key string) (PeerGetter, bool) { return b.peer, true }
+func (b *batchPicker) GetAll() []PeerGetter                   { return []PeerGetter{b.peer} }
+
+func TestGetMultiPeer(t *testing.T) {
+	peer := &fakeBatchPeer{fakePeer: fakePeer{values: map[string]string{"a": "1", "b": "2"}}}
+	g := NewGroup("multi-peer", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		t.Fatalf("key %s should not be loaded locally", key)
+		return nil, nil
+	}))
+	g.RegisterPeers(&batchPicker{peer: peer})
+
+	vals, err := g.GetMulti([]string{"a", "b", "c"})
+	if err != nil || len(vals) != 2 || vals["a"].String() != "1" || vals["b"].String() != "2" {
+		t.Fatalf("GetMulti = %v, %v", vals, err)
+	}
+	if peer.batches != 1 || peer.gets != 0 {
+		t.Fatalf("expect one batch request, got %d batches and %d gets", peer.batches, peer.gets)
+	}
+}
+
+func TestGetMultiPeerErrorFallback(t *testing.T) {
+	peer := &fakeBatchPeer{
+		fakePeer: fakePeer{values: map[string]string{"a": "1"}},
+		errs:     map[string]string{"b": "remote load failed"},
+	}
+	g := NewGroup("multi-peer-error", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local-" + key), nil
+	}))
+	g.RegisterPeers(&batchPicker{peer: peer})
+
+	// 与 Get 相同，远程节点加载失败的 key 从本地加载
+	vals, err := g.GetMulti([]string{"a", "b"})
+	if err != nil || vals["a"].String() != "1" || vals["b"].String() != "local-b" {
+		t.Fatalf("GetMulti = %v, %v", vals, err)
+	}
+}
+
+func TestGetMultiTransports(t *testing.T) {
+	NewGroup("multi-transport", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, &NotFoundError{Key: key}
+	}))
+	keys := []string{"Tom", "unknown", "Sam"}
+	check := func(name string, peer BatchPeerGetter) {
+		out := &pb.MultiResponse{}
+		if err := peer.GetMulti(context.Background(), &pb.MultiRequest{Group: "multi-transport", Keys: keys}, out); err != nil {
+			t.Fatalf("%s: GetMulti failed: %v", name, err)
+		}
+		res := out.GetResponses()
+		if len(res) != 3 || string(res[0].GetValue()) != db["Tom"] || !res[1].GetNotFound() ||
+			string(res[2].GetValue()) != db["Sam"] {
+			t.Fatalf("%s: unexpected responses: %v", name, res)
+		}
+	}
+
+	pool := NewHTTPPool("http://localhost:8001")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+	check("http", pool.newGetter(server.URL))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer lis.Close()
+	go NewRPCPool(lis.Addr().String()).Serve(lis)
+	client := NewRPCPool("127.0.0.1:1")
+	client.Set(lis.Addr().String())
+	peer, _ := client.PickPeer("Tom")
+	check("rpc", peer.(BatchPeerGetter))
+}
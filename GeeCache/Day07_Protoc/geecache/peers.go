@@ -1,11 +1,42 @@
 package geecache
 
+import (
+	"context"
+	pb "geecache/geecachepb"
+)
+
 // PeerPicker 的 PickPeer() 方法用于根据传入的 key 选择相应节点 PeerGetter。
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
+	GetAll() []PeerGetter	// 返回除自己以外的所有节点，用于广播删除等操作
 }
 
-// PeerGetter 的 Get 方法用于在对应 group 中查找缓存值
+// PeerGetter 的 Get 方法用于在对应 group 中查找缓存值，请求与响应均使用 protobuf 消息，
+// 以便之后在不破坏通信格式的前提下增加字段
 type PeerGetter interface {
-	Get(group string, key string) ([]byte, error)	// 回调函数
-}
\ No newline at end of file
+	Get(in *pb.Request, out *pb.Response) error	// 回调函数
+	Remove(in *pb.Request) error	// 删除远程节点上对应 group 中的缓存值
+	Set(in *pb.Request) error	// 将 in.Value 写入远程节点对应 group 中
+}
+
+// ReplicaPicker 是 PeerPicker 的可选接口。key 保存在多个节点上且自己是其中之一时，
+// PickPeer 返回 false，Group.Set 写入本地后再通过 PickReplicas 将值写入其余副本
+type ReplicaPicker interface {
+	PickReplicas(key string) []PeerGetter
+}
+
+// OwnerPicker 是 PeerPicker 的可选接口。PickPeer 可能按本节点的负载等状态选择节点，
+// PickOwner 则只按节点列表选择，所有节点对同一个 key 的结果相同，Group.Set 与 Remove 使用它找到 key 的所属节点
+type OwnerPicker interface {
+	PickOwner(key string) (peer PeerGetter, ok bool)
+}
+
+// ContextPeerGetter 是 PeerGetter 的可选接口，请求远程节点时携带 context，ctx 结束时立即返回
+type ContextPeerGetter interface {
+	GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+// BatchPeerGetter 是 PeerGetter 的可选接口，一次请求远程节点上的多个 key，用于 Group.GetMulti
+type BatchPeerGetter interface {
+	GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error
+}
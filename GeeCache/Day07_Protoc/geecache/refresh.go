@@ -0,0 +1,75 @@
+package geecache
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+/*
+默认情况下值在过期（硬过期）后被删除，下一次访问需要同步等待 Getter 或远程节点，热点 key 过期的瞬间延迟会明显升高。
+开启 WithSoftTTL 后，值在加载 softTTL 之后变为陈旧（软过期）：在硬过期之前访问仍直接返回旧值，
+同时在后台通过 singleflight 重新加载，加载成功后替换旧值。硬过期时间仍由 WithTTL 或 TTLGetter 决定，
+softTTL 不小于硬过期时间的值不会被提前刷新；没有硬过期时间的值每隔 softTTL 刷新一次。
+*/
+
+// WithSoftTTL 设置值的软过期时间，<= 0 表示关闭
+func WithSoftTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.softTTL = ttl
+	}
+}
+
+// refreshAt 计算硬过期时间为 expire 的值的软过期时间，返回零值表示不需要刷新
+func (g *Group) refreshAt(expire time.Time) time.Time {
+	if g.softTTL <= 0 {
+		return time.Time{}
+	}
+	at := time.Now().Add(g.softTTL)
+	if !expire.IsZero() && !at.Before(expire) {
+		return time.Time{}
+	}
+	return at
+}
+
+// refresh 在后台重新加载 which 中已软过期的 key，同一个 key 同时只有一个刷新协程。
+// 加载经过 singleflight，与同时发生的普通加载共享结果
+func (g *Group) refresh(which CacheType, key string) {
+	g.Stats.StaleHits.Add(1)
+	g.refreshMu.Lock()
+	if g.refreshing[key] {
+		g.refreshMu.Unlock()
+		return
+	}
+	if g.refreshing == nil {
+		g.refreshing = make(map[string]bool)
+	}
+	g.refreshing[key] = true
+	g.refreshMu.Unlock()
+
+	go func() {
+		defer func() {
+			g.refreshMu.Lock()
+			delete(g.refreshing, key)
+			g.refreshMu.Unlock()
+		}()
+		g.Stats.Refreshes.Add(1)
+		val, src, err := g.loadFrom(context.Background(), key)
+		switch {
+		case IsNotFound(err):
+			// 数据源中已经不存在，不应再返回旧值
+			g.mainCache.remove(key)
+			g.hotCache.remove(key)
+		case err != nil:
+			g.Stats.RefreshErrors.Add(1)
+			log.Printf("[refresh] group %s refresh key %s failed: %v", g.name, key, err)
+		case which == HotCache:
+			// 从远程节点获取的值只按采样率放入 hotCache，刷新时总是替换旧值
+			g.addToHotCache(key, val)
+		case src == LoadFromPeer:
+			// 旧值在 mainCache 中（例如节点变化后 key 改属其他节点），从远程节点获取的值不会自动写入，
+			// 需要替换旧值，否则之后的每次访问都会返回旧值并再次刷新
+			g.addToCache(key, val, 0)
+		}
+	}()
+}
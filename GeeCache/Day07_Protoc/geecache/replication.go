@@ -0,0 +1,195 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"log"
+	"strings"
+	"sync"
+)
+
+/*
+开启 WithReplication(n, ...) 后，每个 key 属于哈希环上从 key 开始顺时针的 n 个不同节点。
+自己是其中之一时由本地加载并保存在 mainCache 中；否则 PickPeer 返回 replicaGetter，
+按顺序请求各个副本，前一个副本失败时自动尝试下一个，因此单个节点宕机不会丢失它缓存的所有值。
+选择副本时只用 healthy 过滤被熔断的节点，真正发送请求前才调用 allow，避免没有被请求的节点占用探测名额。
+副本之间的写入（Request.Replica 为 true）只更新缓存，数据源只由接收普通写入的副本写入一次。
+*/
+
+var errNoHealthyReplica = errors.New("no healthy replica")
+
+// replicaGetter 实现了 PeerGetter，将请求依次发送给 key 的各个副本节点
+type replicaGetter struct {
+	getters []*httpGetter // 按优先顺序排列，不包含自己
+	fanOut  bool          // Set 是否写入所有副本
+}
+
+func (r *replicaGetter) Get(in *pb.Request, out *pb.Response) error {
+	return r.GetContext(context.Background(), in, out)
+}
+
+// GetContext 依次请求各个副本，直到成功或确认 key 不存在
+func (r *replicaGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	err := errNoHealthyReplica
+	for _, getter := range r.getters {
+		if !getter.health.allow() {
+			continue
+		}
+		out.Reset()
+		if err = getter.GetContext(ctx, in, out); err == nil || IsNotFound(err) || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("[replicaGetter] get from replica %s failed, try next: %v", getter.peer, err)
+	}
+	return err
+}
+
+// GetMulti 与 GetContext 相同，整批请求失败时发送给下一个副本
+func (r *replicaGetter) GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	err := errNoHealthyReplica
+	for _, getter := range r.getters {
+		if !getter.health.allow() {
+			continue
+		}
+		out.Reset()
+		if err = getter.GetMulti(ctx, in, out); err == nil || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("[replicaGetter] batch get from replica %s failed, try next: %v", getter.peer, err)
+	}
+	return err
+}
+
+// Remove 删除所有副本上的值
+func (r *replicaGetter) Remove(in *pb.Request) error {
+	return r.each(r.getters, func(getter *httpGetter) error {
+		return getter.Remove(in)
+	})
+}
+
+// Set 写入第一个成功的副本，由它更新数据源；开启写入扇出时再将值作为副本写入其余副本，只更新它们的缓存
+func (r *replicaGetter) Set(in *pb.Request) error {
+	err := errNoHealthyReplica
+	for i, getter := range r.getters {
+		if !getter.health.allow() {
+			continue
+		}
+		if err = getter.Set(in); err != nil {
+			continue
+		}
+		if !r.fanOut {
+			return nil
+		}
+		others := make([]*httpGetter, 0, len(r.getters)-1)
+		others = append(others, r.getters[:i]...)
+		others = append(others, r.getters[i+1:]...)
+		replica := &pb.Request{Group: in.GetGroup(), Key: in.GetKey(), Value: in.GetValue(), Replica: true}
+		return r.each(others, func(getter *httpGetter) error {
+			return getter.Set(replica)
+		})
+	}
+	return err
+}
+
+// each 并发地对每个可用的副本执行 fn，返回第一个错误
+func (r *replicaGetter) each(getters []*httpGetter, fn func(getter *httpGetter) error) error {
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		rerr    error
+	)
+	for _, getter := range getters {
+		if !getter.health.allow() {
+			continue
+		}
+		wg.Add(1)
+		go func(getter *httpGetter) {
+			defer wg.Done()
+			if err := fn(getter); err != nil {
+				errOnce.Do(func() { rerr = err })
+			}
+		}(getter)
+	}
+	wg.Wait()
+	return rerr
+}
+
+// replicaNodes 返回 key 的 replication 个副本节点，调用时需持有 p.mu
+func (p *HTTPPool) replicaNodes(key string) []string {
+	// 副本需要在所有节点上一致，不使用依赖本地负载的选择结果
+	return consistenthash.GetN(p.ownerPeers(), key, p.replication)
+}
+
+// pickReplicas 是开启复制时的 PickPeer，调用时需持有 p.mu。
+// 自己是副本之一时返回 false 由本地加载；被熔断的副本会被跳过
+func (p *HTTPPool) pickReplicas(key string) (PeerGetter, bool) {
+	nodes := p.replicaNodes(key)
+	for _, node := range nodes {
+		if node == p.self {
+			return nil, false
+		}
+	}
+	getters := make([]*httpGetter, 0, len(nodes))
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		getter := p.httpGetters[node]
+		if !getter.health.healthy() {
+			p.Log("[PickPeer] skip unhealthy replica %s", node)
+			continue
+		}
+		getters = append(getters, getter)
+		names = append(names, node)
+	}
+	switch len(getters) {
+	case 0:
+		return nil, false
+	case 1:
+		// 只剩一个副本时直接返回它，PickPeer 返回后立即发送请求
+		if !getters[0].health.allow() {
+			return nil, false
+		}
+		return getters[0], true
+	}
+
+	// 相同副本列表的 key 共用一个 replicaGetter，GetMulti 才能将它们合并为一次请求
+	id := strings.Join(names, ",")
+	if r, ok := p.replicaGetters[id]; ok {
+		return r, true
+	}
+	if p.replicaGetters == nil {
+		p.replicaGetters = make(map[string]*replicaGetter)
+	}
+	r := &replicaGetter{getters: getters, fanOut: p.fanOutWrites}
+	p.replicaGetters[id] = r
+	p.Log("[PickPeer] Pick replicas %s", id)
+	return r, true
+}
+
+// PickReplicas 实现了 ReplicaPicker：开启写入扇出且自己是 key 的副本之一时，返回其余未被熔断的副本节点。
+// 返回的节点会立即收到副本写入，冷却结束的节点由这次写入的结果决定是否恢复
+func (p *HTTPPool) PickReplicas(key string) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil || p.replication <= 1 || !p.fanOutWrites {
+		return nil
+	}
+	nodes := p.replicaNodes(key)
+	isReplica := false
+	for _, node := range nodes {
+		if node == p.self {
+			isReplica = true
+		}
+	}
+	if !isReplica {
+		return nil
+	}
+	peers := make([]PeerGetter, 0, len(nodes)-1)
+	for _, node := range nodes {
+		if node != p.self && p.httpGetters[node].health.healthy() {
+			peers = append(peers, p.httpGetters[node])
+		}
+	}
+	return peers
+}
@@ -0,0 +1,757 @@
+package geecache
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+RPCPool 是 HTTPPool 之外的另一种节点间通信方式。
+每个远程节点只维护一条长连接，所有请求都在这条连接上复用：
+请求带有递增的编号 seq，响应按 seq 找到对应的请求，因此同一连接上可以同时存在多个未完成的请求，
+不需要像 http.Get 那样为每次缓存未命中建立新连接。
+
+每个请求/响应帧的格式为：
+
+	| seq (8 字节) | op (1 字节) | body 长度 (4 字节) | body (protobuf) |
+
+请求的 body 为 pb.Request，响应的 body 为 pb.Response；批量查找时分别为 pb.MultiRequest 与 pb.MultiResponse。
+
+与 HTTPPool 一样，RPCPool 支持熔断（WithRPCCircuitBreaker）、运行时增删节点（AddPeer、RemovePeer、WatchPeers）与认证：
+
+  - WithRPCTLS：连接使用双向 TLS，对方必须出示由指定 CA 签发的证书；
+  - WithRPCSharedSecret / WithRPCPeerKeys：连接建立后先完成一次挑战-应答，服务端发送随机数（rpcOpChallenge），
+    客户端以自己的密钥返回对随机数与节点地址的 HMAC-SHA256（rpcOpAuth），校验通过后才处理该连接上的请求。
+
+认证针对整条连接而不是单个请求，随机数保证截获的应答无法在其他连接上重放；挑战-应答不加密内容，在不可信的网络中需要同时使用 WithRPCTLS。
+*/
+
+const (
+	rpcOpGet       byte = iota + 1 // 查找缓存值
+	rpcOpRemove                    // 删除缓存值
+	rpcOpSet                       // 写入缓存值
+	rpcOpGetMulti                  // 批量查找缓存值
+	rpcOpChallenge                 // 服务端发送的认证随机数
+	rpcOpAuth                      // 客户端的认证应答，以及服务端的认证结果
+
+	rpcHeaderLen       = 8 + 1 + 4
+	rpcMaxBodyLen      = 64 << 20 // 单个帧 body 的最大长度，防止异常数据导致分配过多内存
+	rpcMaxAuthLen      = 4 << 10  // 认证帧 body 的最大长度，认证之前不接受大的帧
+	rpcNonceLen        = 16
+	defaultDialTimeout = 3 * time.Second
+)
+
+var errRPCShutdown = errors.New("rpc connection is shut down")
+
+// rpcHeader 是每一帧的帧头
+type rpcHeader struct {
+	seq  uint64
+	op   byte
+	size uint32
+}
+
+func writeFrame(w io.Writer, h rpcHeader, body []byte) error {
+	var buf [rpcHeaderLen]byte
+	binary.BigEndian.PutUint64(buf[0:8], h.seq)
+	buf[8] = h.op
+	binary.BigEndian.PutUint32(buf[9:13], uint32(len(body)))
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+func readFrame(r io.Reader) (rpcHeader, []byte, error) {
+	return readFrameLimit(r, rpcMaxBodyLen)
+}
+
+// readFrameLimit 读取一帧，body 长度超过 limit 时返回错误
+func readFrameLimit(r io.Reader, limit uint32) (rpcHeader, []byte, error) {
+	var (
+		buf [rpcHeaderLen]byte
+		h   rpcHeader
+	)
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return h, nil, err
+	}
+	h.seq = binary.BigEndian.Uint64(buf[0:8])
+	h.op = buf[8]
+	h.size = binary.BigEndian.Uint32(buf[9:13])
+	if h.size > limit {
+		return h, nil, fmt.Errorf("rpc frame too large: %d", h.size)
+	}
+	body := make([]byte, h.size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return h, nil, err
+	}
+	return h, body, nil
+}
+
+// rpcSignature 计算客户端对认证随机数的应答
+func rpcSignature(key []byte, peer string, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "geecache-rpc\n%s\n", peer)
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+// rpcResult 是一个请求的结果，out 是接收协程新建并解码的响应
+type rpcResult struct {
+	out proto.Message
+	err error
+}
+
+// rpcCall 表示一个正在等待响应的请求。
+// 接收协程把响应解码到新建的 out 中再通过 done 交给调用方，调用方因 ctx 结束返回后不会再被写入
+type rpcCall struct {
+	out  proto.Message
+	done chan rpcResult // 收到响应或连接断开时写入一次，带有 1 个缓冲，不会阻塞接收协程
+}
+
+// rpcGetter 实现了 PeerGetter，对应一个远程节点
+type rpcGetter struct {
+	addr      string      // 远程节点的地址，例如 localhost:8001
+	health    *peerHealth // 记录该节点的健康状况
+	auth      *peerAuth   // 不为 nil 时建立连接后以 self 的身份完成认证
+	self      string      // 本节点的地址
+	tlsConfig *tls.Config // 不为 nil 时使用 TLS 连接
+	mu        sync.Mutex
+	sending   sync.Mutex // 保证多个请求的帧不会交错写入
+	conn      net.Conn   // 为 nil 时在下一次请求时重新建立连接
+	w         *bufio.Writer
+	seq       uint64
+	pending   map[uint64]*rpcCall // 存储未完成的请求，键是编号
+	closed    bool                // 节点已从 RPCPool 中移除，不再建立连接
+}
+
+func (r *rpcGetter) Get(in *pb.Request, out *pb.Response) error {
+	return r.GetContext(context.Background(), in, out)
+}
+
+// GetContext 在 ctx 结束时放弃等待响应，连接仍然保留给其他请求使用
+func (r *rpcGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	if err := r.call(ctx, rpcOpGet, in, out); err != nil {
+		return err
+	}
+	if out.GetNotFound() {
+		return &NotFoundError{Key: in.GetKey()}
+	}
+	if out.GetError() != "" {
+		return errors.New(out.GetError())
+	}
+	return nil
+}
+
+// GetMulti 在同一条连接上发送一次批量查找请求
+func (r *rpcGetter) GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	return r.call(ctx, rpcOpGetMulti, in, out)
+}
+
+func (r *rpcGetter) Remove(in *pb.Request) error {
+	out := &pb.Response{}
+	if err := r.call(context.Background(), rpcOpRemove, in, out); err != nil {
+		return err
+	}
+	if out.GetError() != "" {
+		return errors.New(out.GetError())
+	}
+	return nil
+}
+
+func (r *rpcGetter) Set(in *pb.Request) error {
+	out := &pb.Response{}
+	if err := r.call(context.Background(), rpcOpSet, in, out); err != nil {
+		return err
+	}
+	if out.GetError() != "" {
+		return errors.New(out.GetError())
+	}
+	return nil
+}
+
+// call 发送请求并等待响应，并根据结果更新节点的健康状况。
+// 远程节点在 Response 中带回的错误说明节点本身是健康的，只有连接出错或等待超时才记为失败
+func (r *rpcGetter) call(ctx context.Context, op byte, in, out proto.Message) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if r.conn == nil {
+		if err := r.dial(); err != nil {
+			r.mu.Unlock()
+			r.health.failure()
+			return err
+		}
+	}
+	conn, w := r.conn, r.w
+	r.seq++
+	seq := r.seq
+	c := &rpcCall{out: out.ProtoReflect().New().Interface(), done: make(chan rpcResult, 1)}
+	r.pending[seq] = c
+	r.mu.Unlock()
+
+	r.sending.Lock()
+	err = writeFrame(w, rpcHeader{seq: seq, op: op}, body)
+	if err == nil {
+		err = w.Flush()
+	}
+	r.sending.Unlock()
+	if err != nil {
+		r.shutdown(conn, err)
+	}
+
+	select {
+	case res := <-c.done:
+		if res.err != nil {
+			r.health.failure()
+			return res.err
+		}
+		proto.Reset(out)
+		proto.Merge(out, res.out)
+		r.health.success()
+		return nil
+	case <-ctx.Done():
+		// 之后到达的响应找不到对应的请求，会被直接丢弃
+		r.mu.Lock()
+		delete(r.pending, seq)
+		r.mu.Unlock()
+		// 与 httpGetter.requestFailed 相同，调用方主动取消不代表节点不健康
+		if errors.Is(ctx.Err(), context.Canceled) {
+			r.health.abandon()
+		} else {
+			r.health.failure()
+		}
+		return ctx.Err()
+	}
+}
+
+// dial 建立连接、完成认证并启动接收协程，调用时需持有 r.mu
+func (r *rpcGetter) dial() error {
+	if r.closed {
+		return errRPCShutdown
+	}
+	dialer := &net.Dialer{Timeout: defaultDialTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if r.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.addr, r.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", r.addr)
+	}
+	if err != nil {
+		return err
+	}
+	if r.auth != nil {
+		if err := r.authenticate(conn); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	r.conn = conn
+	r.w = bufio.NewWriter(conn)
+	if r.pending == nil {
+		r.pending = make(map[uint64]*rpcCall)
+	}
+	go r.receive(conn)
+	return nil
+}
+
+// receive 不断读取响应，根据 seq 唤醒对应的请求
+func (r *rpcGetter) receive(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		h, body, err := readFrame(reader)
+		if err != nil {
+			r.shutdown(conn, err)
+			return
+		}
+		r.mu.Lock()
+		c := r.pending[h.seq]
+		delete(r.pending, h.seq)
+		r.mu.Unlock()
+		if c == nil {
+			continue
+		}
+		res := rpcResult{out: c.out}
+		if err := proto.Unmarshal(body, c.out); err != nil {
+			res.err = fmt.Errorf("decoding response body: %v", err)
+		}
+		c.done <- res
+	}
+}
+
+// authenticate 读取服务端发送的随机数，以 self 的身份返回应答，并等待服务端的认证结果
+func (r *rpcGetter) authenticate(conn net.Conn) error {
+	key, ok := r.auth.key(r.self)
+	if !ok {
+		return fmt.Errorf("no signing key for %s", r.self)
+	}
+	conn.SetDeadline(time.Now().Add(defaultDialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	h, nonce, err := readFrameLimit(conn, rpcMaxAuthLen)
+	if err != nil {
+		return fmt.Errorf("reading challenge: %v", err)
+	}
+	if h.op != rpcOpChallenge || len(nonce) != rpcNonceLen {
+		return fmt.Errorf("unexpected challenge frame: op %d", h.op)
+	}
+	answer := append(rpcSignature(key, r.self, nonce), r.self...)
+	if err := writeFrame(conn, rpcHeader{op: rpcOpAuth}, answer); err != nil {
+		return err
+	}
+	h, body, err := readFrameLimit(conn, rpcMaxAuthLen)
+	if err != nil {
+		return fmt.Errorf("reading auth result: %v", err)
+	}
+	res := &pb.Response{}
+	if h.op != rpcOpAuth || proto.Unmarshal(body, res) != nil {
+		return fmt.Errorf("unexpected auth result frame: op %d", h.op)
+	}
+	if res.GetError() != "" {
+		return errors.New(res.GetError())
+	}
+	return nil
+}
+
+// shutdown 关闭出错的连接，并让该连接上所有未完成的请求返回错误，下一次请求会重新建立连接
+func (r *rpcGetter) shutdown(conn net.Conn, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn != conn {
+		return
+	}
+	conn.Close()
+	r.conn = nil
+	if err == io.EOF {
+		err = errRPCShutdown
+	}
+	for seq, c := range r.pending {
+		c.done <- rpcResult{err: err}
+		delete(r.pending, seq)
+	}
+}
+
+// close 关闭与远程节点的连接，之后的请求直接返回 errRPCShutdown
+func (r *rpcGetter) close() {
+	r.mu.Lock()
+	r.closed = true
+	conn := r.conn
+	r.mu.Unlock()
+	if conn != nil {
+		r.shutdown(conn, errRPCShutdown)
+	}
+}
+
+// RPCPool implements PeerPicker for a pool of peers connected by long-lived TCP connections.
+type RPCPool struct {
+	self             string // 用来记录自己的地址，例如 localhost:8001
+	mu               sync.Mutex
+	peers            *consistenthash.Map
+	rpcGetters       map[string]*rpcGetter // 映射远程节点与对应的 rpcGetter
+	failureThreshold int                   // 连续失败多少次后熔断，<= 0 表示不熔断
+	cooldown         time.Duration         // 熔断持续时间
+	auth             *peerAuth             // 连接认证的密钥，为 nil 表示不认证
+	tlsConfig        *tls.Config           // 节点间的双向 TLS 配置，为 nil 表示不使用 TLS
+}
+
+// RPCPoolOption 用于在 NewRPCPool 时对 RPCPool 进行可选配置
+type RPCPoolOption func(*RPCPool)
+
+// WithRPCCircuitBreaker 与 WithCircuitBreaker 相同：连续失败 threshold 次后，cooldown 时间内 PickPeer 跳过该节点
+func WithRPCCircuitBreaker(threshold int, cooldown time.Duration) RPCPoolOption {
+	return func(p *RPCPool) {
+		p.failureThreshold = threshold
+		p.cooldown = cooldown
+	}
+}
+
+// WithRPCSharedSecret 使所有节点使用同一个密钥完成连接认证
+func WithRPCSharedSecret(secret []byte) RPCPoolOption {
+	return func(p *RPCPool) {
+		p.authOrNew().secret = secret
+	}
+}
+
+// WithRPCPeerKeys 与 WithPeerKeys 相同，为每个节点设置各自的密钥，以节点地址为 key
+func WithRPCPeerKeys(keys map[string][]byte) RPCPoolOption {
+	return func(p *RPCPool) {
+		p.authOrNew().keys = keys
+	}
+}
+
+// WithRPCTLS 设置节点间的双向 TLS：config 用于连接其他节点，同时 Serve 只接受出示了已验证证书的连接。
+// config 可以由 MutualTLSConfig 创建
+func WithRPCTLS(config *tls.Config) RPCPoolOption {
+	return func(p *RPCPool) {
+		p.tlsConfig = config
+	}
+}
+
+func NewRPCPool(self string, opts ...RPCPoolOption) *RPCPool {
+	p := &RPCPool{
+		self:             self,
+		failureThreshold: defaultFailureThreshold,
+		cooldown:         defaultCooldown,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *RPCPool) authOrNew() *peerAuth {
+	if p.auth == nil {
+		p.auth = &peerAuth{maxSkew: defaultMaxClockSkew}
+	}
+	return p.auth
+}
+
+// Log server name info
+func (p *RPCPool) Log(format string, v ...interface{}) {
+	log.Printf("[RPC Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// Set 实例化一致性哈希，添加传入节点，并关闭旧节点的连接
+func (p *RPCPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, getter := range p.rpcGetters {
+		getter.close()
+	}
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	p.rpcGetters = make(map[string]*rpcGetter, len(peers))
+	for _, peer := range peers {
+		p.rpcGetters[peer] = p.newGetter(peer)
+	}
+}
+
+func (p *RPCPool) newGetter(peer string) *rpcGetter {
+	return &rpcGetter{
+		addr:      peer,
+		health:    newPeerHealth(p.failureThreshold, p.cooldown),
+		auth:      p.auth,
+		self:      p.self,
+		tlsConfig: p.tlsConfig,
+	}
+}
+
+// AddPeer 在运行时加入节点，只会为新节点添加虚拟节点，不会重建整个哈希环
+func (p *RPCPool) AddPeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		p.peers = consistenthash.New(defaultReplicas, nil)
+		p.rpcGetters = make(map[string]*rpcGetter)
+	}
+	for _, peer := range peers {
+		if _, ok := p.rpcGetters[peer]; ok {
+			continue
+		}
+		p.peers.Add(peer)
+		p.rpcGetters[peer] = p.newGetter(peer)
+		p.Log("[AddPeer] peer %s joined", peer)
+	}
+}
+
+// RemovePeer 在运行时移除节点并关闭与它的连接，原本属于该节点的 key 会落到哈希环上的下一个节点
+func (p *RPCPool) RemovePeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, peer := range peers {
+		getter, ok := p.rpcGetters[peer]
+		if !ok {
+			continue
+		}
+		p.peers.Remove(peer)
+		delete(p.rpcGetters, peer)
+		getter.close()
+		p.Log("[RemovePeer] peer %s left", peer)
+	}
+}
+
+// Peers 返回当前所有节点，包括自己
+func (p *RPCPool) Peers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]string, 0, len(p.rpcGetters))
+	for peer := range p.rpcGetters {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// SyncPeers 将节点列表更新为 peers，只对新增与离开的节点调用 AddPeer 和 RemovePeer
+func (p *RPCPool) SyncPeers(peers []string) {
+	added, removed := diffPeers(p.Peers(), peers)
+	p.RemovePeer(removed...)
+	p.AddPeer(added...)
+}
+
+// WatchPeers 与 HTTPPool.WatchPeers 相同，定期从 src 同步节点列表，返回的 stop 用于停止同步
+func (p *RPCPool) WatchPeers(src PeerSource, interval time.Duration) (stop func()) {
+	return watchPeers(src, interval, p.SyncPeers)
+}
+
+// PickPeer 根据具体的 key 选择节点，返回节点对应的 rpcGetter。
+// 所属节点被熔断时，顺着哈希环选择下一个健康的节点；若选中的是自己，则返回 false 由本地加载
+func (p *RPCPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	var picked *rpcGetter
+	p.peers.Walk(key, func(peer string) bool {
+		if peer == p.self {
+			return false
+		}
+		getter := p.rpcGetters[peer]
+		if !getter.health.allow() {
+			p.Log("[PickPeer] skip unhealthy peer %s", peer)
+			return true
+		}
+		p.Log("[PickPeer] Pick peer %s", peer)
+		picked = getter
+		return false
+	})
+	if picked == nil {
+		return nil, false
+	}
+	return picked, true
+}
+
+// Healthy 返回各节点当前是否可用，不包括自己
+func (p *RPCPool) Healthy() map[string]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	healthy := make(map[string]bool, len(p.rpcGetters))
+	for peer, getter := range p.rpcGetters {
+		if peer != p.self {
+			healthy[peer] = getter.health.healthy()
+		}
+	}
+	return healthy
+}
+
+// GetAll 返回除自己以外所有节点对应的 rpcGetter
+func (p *RPCPool) GetAll() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]PeerGetter, 0, len(p.rpcGetters))
+	for peer, getter := range p.rpcGetters {
+		if peer != p.self {
+			getters = append(getters, getter)
+		}
+	}
+	return getters
+}
+
+// ListenAndServe 监听 self 地址并处理其他节点的请求
+func (p *RPCPool) ListenAndServe() error {
+	lis, err := net.Listen("tcp", p.self)
+	if err != nil {
+		return err
+	}
+	return p.Serve(lis)
+}
+
+// Serve 在 lis 上接受连接，每个连接由一个协程负责读取请求。设置了 WithRPCTLS 时连接使用 TLS
+func (p *RPCPool) Serve(lis net.Listener) error {
+	if p.tlsConfig != nil {
+		lis = tls.NewListener(lis, p.tlsConfig)
+	}
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go p.serveConn(conn)
+	}
+}
+
+// serveConn 读取一个连接上的所有请求，每个请求在单独的协程中处理，处理完后按 seq 写回响应
+func (p *RPCPool) serveConn(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	if err := p.authorize(conn, reader, writer); err != nil {
+		p.Log("[serveConn] %v from %s", err, conn.RemoteAddr())
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		sending sync.Mutex
+		wg      sync.WaitGroup
+	)
+	for {
+		h, body, err := readFrame(reader)
+		if err != nil {
+			if err != io.EOF {
+				p.Log("[serveConn] read frame error: %v", err)
+			}
+			break
+		}
+		wg.Add(1)
+		go func(h rpcHeader, body []byte) {
+			defer wg.Done()
+			res := p.handle(ctx, h.op, body)
+			out, err := proto.Marshal(res)
+			if err != nil {
+				p.Log("[serveConn] encode response error: %v", err)
+				return
+			}
+			sending.Lock()
+			defer sending.Unlock()
+			if err := writeFrame(writer, rpcHeader{seq: h.seq, op: h.op}, out); err == nil {
+				writer.Flush()
+			}
+		}(h, body)
+	}
+	wg.Wait()
+}
+
+// authorize 在处理请求之前检查连接是否来自可信的节点：TLS 连接需出示已验证的证书，
+// 开启认证时发送随机数并校验客户端的应答，结果以 rpcOpAuth 帧返回给客户端
+func (p *RPCPool) authorize(conn net.Conn, reader io.Reader, writer *bufio.Writer) error {
+	conn.SetDeadline(time.Now().Add(defaultDialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if p.tlsConfig != nil {
+		tlsConn, ok := conn.(*tls.Conn)
+		if !ok {
+			return fmt.Errorf("%w: TLS required", errUnauthorized)
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			return fmt.Errorf("%w: %v", errUnauthorized, err)
+		}
+		if len(tlsConn.ConnectionState().VerifiedChains) == 0 {
+			return fmt.Errorf("%w: client certificate required", errUnauthorized)
+		}
+	}
+	if p.auth == nil {
+		return nil
+	}
+
+	nonce := make([]byte, rpcNonceLen)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	if err := writeFrame(writer, rpcHeader{op: rpcOpChallenge}, nonce); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	h, body, err := readFrameLimit(reader, rpcMaxAuthLen)
+	if err != nil {
+		return fmt.Errorf("reading auth frame: %v", err)
+	}
+	err = p.verify(h, nonce, body)
+	res := &pb.Response{}
+	if err != nil {
+		res.Error = errUnauthorized.Error()
+	}
+	if out, merr := proto.Marshal(res); merr == nil && writeFrame(writer, rpcHeader{op: rpcOpAuth}, out) == nil {
+		writer.Flush()
+	}
+	return err
+}
+
+// verify 校验客户端对 nonce 的应答，body 为签名与节点地址
+func (p *RPCPool) verify(h rpcHeader, nonce, body []byte) error {
+	if h.op != rpcOpAuth || len(body) < sha256.Size {
+		return fmt.Errorf("%w: bad auth frame", errUnauthorized)
+	}
+	sig, peer := body[:sha256.Size], string(body[sha256.Size:])
+	key, ok := p.auth.key(peer)
+	if !ok {
+		return fmt.Errorf("%w: unknown peer %q", errUnauthorized, peer)
+	}
+	if !hmac.Equal(sig, rpcSignature(key, peer, nonce)) {
+		return fmt.Errorf("%w: bad signature", errUnauthorized)
+	}
+	return nil
+}
+
+// handle 处理一个请求，错误通过 Response.Error 返回。ctx 在连接断开时结束
+func (p *RPCPool) handle(ctx context.Context, op byte, body []byte) proto.Message {
+	if op == rpcOpGetMulti {
+		return p.handleMulti(ctx, body)
+	}
+	in := &pb.Request{}
+	if err := proto.Unmarshal(body, in); err != nil {
+		return &pb.Response{Error: "bad request: " + err.Error()}
+	}
+	p.Log("op %d %s/%s", op, in.GetGroup(), in.GetKey())
+
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return &pb.Response{Error: "no such group: " + in.GetGroup()}
+	}
+	group.Stats.ServerRequests.Add(1)
+
+	switch op {
+	case rpcOpGet:
+		view, err := group.GetContext(ctx, in.GetKey())
+		if err != nil {
+			return &pb.Response{Error: err.Error(), NotFound: IsNotFound(err)}
+		}
+		return &pb.Response{Value: view.ByteSlice()}
+	case rpcOpRemove:
+		group.removeLocally(in.GetKey())
+		return &pb.Response{}
+	case rpcOpSet:
+		if err := group.setFromPeer(in.GetKey(), in); err != nil {
+			return &pb.Response{Error: err.Error()}
+		}
+		return &pb.Response{}
+	default:
+		return &pb.Response{Error: fmt.Sprintf("unknown op: %d", op)}
+	}
+}
+
+// handleMulti 处理批量查找请求，请求格式错误或 group 不存在时返回空的 MultiResponse，
+// 客户端会因为响应个数不匹配而视为失败
+func (p *RPCPool) handleMulti(ctx context.Context, body []byte) proto.Message {
+	in := &pb.MultiRequest{}
+	if err := proto.Unmarshal(body, in); err != nil {
+		p.Log("[handleMulti] bad request: %v", err)
+		return &pb.MultiResponse{}
+	}
+	p.Log("op %d %s/%d keys", rpcOpGetMulti, in.GetGroup(), len(in.GetKeys()))
+
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return &pb.MultiResponse{}
+	}
+	group.Stats.ServerRequests.Add(1)
+	vals, errs := group.getMulti(ctx, in.GetKeys())
+	return multiResponse(in.GetKeys(), vals, errs)
+}
@@ -0,0 +1,242 @@
+package geecache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRPCPool(t *testing.T) {
+	group := NewGroup("rpc", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer lis.Close()
+	server := NewRPCPool(lis.Addr().String())
+	go server.Serve(lis)
+
+	client := NewRPCPool("127.0.0.1:1")
+	client.Set(lis.Addr().String())
+	peer, ok := client.PickPeer("Tom")
+	if !ok {
+		t.Fatal("should pick the remote peer")
+	}
+
+	// 多个请求并发复用同一条连接
+	var wg sync.WaitGroup
+	for k, v := range db {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(k, v string) {
+				defer wg.Done()
+				res := &pb.Response{}
+				if err := peer.Get(&pb.Request{Group: "rpc", Key: k}, res); err != nil || string(res.Value) != v {
+					t.Errorf("failed to get %s over rpc: %v, value: %q", k, err, res.Value)
+				}
+			}(k, v)
+		}
+	}
+	wg.Wait()
+
+	err = peer.Get(&pb.Request{Group: "rpc", Key: "unknown"}, &pb.Response{})
+	if err == nil || err.Error() != "unknown not exist" {
+		t.Fatalf("remote error should be carried in Response, got %v", err)
+	}
+
+	if err := peer.Remove(&pb.Request{Group: "rpc", Key: "Tom"}); err != nil {
+		t.Fatalf("remove over rpc failed: %v", err)
+	}
+	if _, ok := group.mainCache.get("Tom"); ok {
+		t.Fatal("Tom should be removed on the remote peer")
+	}
+}
+
+// serveRPC 在随机端口上启动一个 RPCPool 服务，返回它的地址
+func serveRPC(t *testing.T, opts ...RPCPoolOption) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	go NewRPCPool(lis.Addr().String(), opts...).Serve(lis)
+	return lis.Addr().String()
+}
+
+func TestRPCCircuitBreaker(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := lis.Addr().String()
+	lis.Close()
+
+	pool := NewRPCPool("127.0.0.1:1", WithRPCCircuitBreaker(1, time.Hour))
+	pool.Set(dead)
+	peer, ok := pool.PickPeer("Tom")
+	if !ok {
+		t.Fatal("should pick the remote peer")
+	}
+	if err := peer.Get(&pb.Request{Group: "rpc", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatal("request to a dead peer should fail")
+	}
+	if pool.Healthy()[dead] {
+		t.Fatal("dead peer should be marked unhealthy")
+	}
+	if _, ok := pool.PickPeer("Tom"); ok {
+		t.Fatal("unhealthy peer should be skipped")
+	}
+}
+
+func TestRPCAddRemovePeer(t *testing.T) {
+	NewGroup("rpc-members", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	addr := serveRPC(t)
+
+	pool := NewRPCPool("127.0.0.1:1")
+	pool.AddPeer("127.0.0.1:1", addr)
+	pool.AddPeer(addr)
+	if expect := []string{"127.0.0.1:1", addr}; !reflect.DeepEqual(pool.Peers(), expect) {
+		t.Fatalf("peers %v, expect %v", pool.Peers(), expect)
+	}
+	getter := pool.rpcGetters[addr]
+	if err := getter.Get(&pb.Request{Group: "rpc-members", Key: "Tom"}, &pb.Response{}); err != nil {
+		t.Fatalf("get over rpc failed: %v", err)
+	}
+
+	// 离开的节点会关闭连接，之后不再建立新连接
+	pool.SyncPeers([]string{"127.0.0.1:1"})
+	if peers := pool.Peers(); len(peers) != 1 {
+		t.Fatalf("unexpected peers after sync: %v", peers)
+	}
+	if err := getter.Get(&pb.Request{Group: "rpc-members", Key: "Tom"}, &pb.Response{}); err != errRPCShutdown {
+		t.Fatalf("removed peer should not reconnect, got %v", err)
+	}
+	if _, ok := pool.PickPeer("Tom"); ok {
+		t.Fatal("Tom should belong to self after peer left")
+	}
+}
+
+func TestRPCAuth(t *testing.T) {
+	NewGroup("rpc-auth", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	get := func(addr string, opts ...RPCPoolOption) (string, error) {
+		pool := NewRPCPool("127.0.0.1:1", opts...)
+		defer pool.RemovePeer(addr)
+		pool.Set(addr)
+		res := &pb.Response{}
+		err := pool.rpcGetters[addr].Get(&pb.Request{Group: "rpc-auth", Key: "Tom"}, res)
+		return string(res.Value), err
+	}
+
+	addr := serveRPC(t, WithRPCSharedSecret([]byte("secret")))
+	if v, err := get(addr, WithRPCSharedSecret([]byte("secret"))); err != nil || v != "Tom" {
+		t.Fatalf("authenticated get = %q, %v", v, err)
+	}
+	if _, err := get(addr, WithRPCSharedSecret([]byte("wrong"))); err == nil || err.Error() != errUnauthorized.Error() {
+		t.Fatalf("wrong secret should be rejected, got %v", err)
+	}
+	if _, err := get(addr); err == nil {
+		t.Fatal("unauthenticated connection should be rejected")
+	}
+	if _, err := get(addr, WithRPCPeerKeys(map[string][]byte{"127.0.0.1:1": []byte("secret")})); err != nil {
+		t.Fatalf("peer key matching the server should be accepted, got %v", err)
+	}
+
+	certFile, keyFile, caFile := writeTestCerts(t, t.TempDir())
+	config, err := MutualTLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr = serveRPC(t, WithRPCTLS(config))
+	if v, err := get(addr, WithRPCTLS(config)); err != nil || v != "Tom" {
+		t.Fatalf("mTLS get = %q, %v", v, err)
+	}
+	noCert := config.Clone()
+	noCert.Certificates = nil
+	if _, err := get(addr, WithRPCTLS(noCert)); err == nil {
+		t.Fatal("connection without client certificate should fail")
+	}
+	if _, err := get(addr); err == nil {
+		t.Fatal("plain connection should fail")
+	}
+}
+
+// TestRPCCancelledCall 检查调用方因 ctx 取消返回后，迟到的响应不会写入调用方的 out
+func TestRPCCancelledCall(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	release := make(chan struct{})
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		// 第一个请求在 release 之后才响应，第二个请求立即响应
+		for i := 0; ; i++ {
+			h, _, err := readFrame(reader)
+			if err != nil {
+				return
+			}
+			if i == 0 {
+				<-release
+			}
+			body, _ := proto.Marshal(&pb.Response{Value: []byte(fmt.Sprint("late", i))})
+			if writeFrame(conn, rpcHeader{seq: h.seq, op: h.op}, body) != nil {
+				return
+			}
+		}
+	}()
+
+	pool := NewRPCPool("127.0.0.1:1", WithRPCCircuitBreaker(1, time.Hour))
+	pool.Set(lis.Addr().String())
+	getter := pool.rpcGetters[lis.Addr().String()]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &pb.Response{}
+	done := make(chan error)
+	go func() { done <- getter.GetContext(ctx, &pb.Request{Group: "rpc", Key: "Tom"}, out) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled call should return context.Canceled, got %v", err)
+	}
+	close(release)
+
+	// 第二个响应在迟到的响应之后到达，收到它时迟到的响应已经处理完
+	res := &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: "rpc", Key: "Jack"}, res); err != nil || string(res.Value) != "late1" {
+		t.Fatalf("second call = %q, %v", res.Value, err)
+	}
+	if out.Value != nil {
+		t.Fatalf("late response should not be written to the cancelled call, got %q", out.Value)
+	}
+	if !pool.Healthy()[lis.Addr().String()] {
+		t.Fatal("cancelled call should not mark the peer unhealthy")
+	}
+}
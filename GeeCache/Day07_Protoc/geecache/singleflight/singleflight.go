@@ -1,12 +1,37 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
 
 // call 表示正在进行中，或者已经结束的请求
 type call struct {
-	wg	sync.WaitGroup	// 避免重入
+	done	chan struct{}	// 请求结束时关闭，等待者可以同时监听 ctx，避免一直阻塞
 	val	interface{}
 	err error
+	dups	int	// 共享这次请求的其他调用者数量
+	chans	[]chan<- Result	// DoChan 的调用者，请求结束时将结果发送给它们
+}
+
+// Result 是 DoChan 返回的结果，Shared 表示结果是否同时被多个调用者共享
+type Result struct {
+	Val	interface{}
+	Err	error
+	Shared	bool
+}
+
+// PanicError 表示 fn 发生了 panic，Value 是 panic 的值，Stack 是发生 panic 时的调用栈。
+// fn panic 时所有等待者都会得到这个错误，而不是一直阻塞。
+type PanicError struct {
+	Value	interface{}
+	Stack	[]byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: fn panicked: %v\n\n%s", p.Value, p.Stack)
 }
 
 // Group 用于管理不同 key 的请求（call
@@ -17,28 +42,122 @@ type Group struct {
 
 // Do 方法，接收 2 个参数，第一个参数是 key，第二个参数是一个函数 fn。
 // Do 的作用就是，针对相同的 key，无论 Do 被调用多少次，函数 fn 都只会被调用一次，等待 fn 调用结束了，返回返回值或错误。
-func (group *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+// shared 表示结果是否同时被多个调用者共享。
+func (group *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
 	group.mu.Lock()
 	if group.m == nil {
 		group.m = make(map[string]*call)
 	}
 	if c, ok := group.m[key]; ok {
+		c.dups++
 		group.mu.Unlock()
-		c.wg.Wait()		// 如果请求正在进行中， 则等待
-		return c.val, c.err
+		<-c.done		// 如果请求正在进行中， 则等待
+		return c.val, c.err, true
 	}
 	// 若之前没有请求过，那么构建新的
-	c := new(call)
-	c.wg.Add(1)		// 发请求前加锁
+	c := &call{done: make(chan struct{})}
 	group.m[key] = c
 	group.mu.Unlock()
 
-	c.val, c.err = fn()		// 调用 fn 。发起请求
-	c.wg.Done()				// 请求结束  wg.Done() 锁减1。
+	shared = group.doCall(c, key, fn)		// 调用 fn 。发起请求
+	return c.val, c.err, shared
+}
+
+// DoChan 与 Do 相同，但不阻塞，返回一个在请求结束时接收结果的 channel，fn 在单独的协程中执行
+func (group *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch, _ := group.DoChanLeader(key, fn)
+	return ch
+}
+
+// DoChanLeader 与 DoChan 相同，leader 表示本次调用发起了新的请求、fn 会被执行；
+// 为 false 时已有相同 key 的请求在进行中，fn 不会被执行，结果来自那次请求
+func (group *Group) DoChanLeader(key string, fn func() (interface{}, error)) (ch <-chan Result, leader bool) {
+	res := make(chan Result, 1)
+	group.mu.Lock()
+	if group.m == nil {
+		group.m = make(map[string]*call)
+	}
+	if c, ok := group.m[key]; ok {
+		c.dups++
+		c.chans = append(c.chans, res)
+		group.mu.Unlock()
+		return res, false
+	}
+	c := &call{done: make(chan struct{}), chans: []chan<- Result{res}}
+	group.m[key] = c
+	group.mu.Unlock()
+
+	go group.doCall(c, key, fn)
+	return res, true
+}
 
+// DoContext 与 Do 相同，但 fn 在单独的协程中执行，每个调用者都可以在 ctx 结束时放弃等待并返回 ctx.Err()，
+// 而不会取消其他调用者共享的 fn。
+func (group *Group) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	group.mu.Lock()
+	if group.m == nil {
+		group.m = make(map[string]*call)
+	}
+	c, ok := group.m[key]
+	if ok {
+		c.dups++
+	} else {
+		c = &call{done: make(chan struct{})}
+		group.m[key] = c
+		go group.doCall(c, key, fn)
+	}
+	group.mu.Unlock()
+
+	select {
+	case <-c.done:
+		group.mu.Lock()
+		shared = c.dups > 0
+		group.mu.Unlock()
+		return c.val, c.err, shared
+	case <-ctx.Done():
+		return nil, ctx.Err(), false
+	}
+}
+
+// Dups 返回 key 对应的进行中的请求中，除发起者以外正在共享它的调用者数量，没有进行中的请求时返回 0
+func (group *Group) Dups(key string) int {
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	if c, ok := group.m[key]; ok {
+		return c.dups
+	}
+	return 0
+}
+
+// Forget 让 key 对应的请求不再被后续调用共享，之后对该 key 的调用会重新执行 fn。
+// 已经在等待的调用者仍会得到原来请求的结果。
+func (group *Group) Forget(key string) {
 	group.mu.Lock()
 	delete(group.m, key)
 	group.mu.Unlock()
+}
+
+// doCall 执行 fn，结束后删除 key 并唤醒所有等待者。fn 发生 panic 时转换为 PanicError 返回给所有调用者
+func (group *Group) doCall(c *call, key string, fn func() (interface{}, error)) (shared bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.val, c.err = nil, &PanicError{Value: r, Stack: debug.Stack()}
+		}
+
+		group.mu.Lock()
+		// 调用过 Forget 后，key 可能已经对应一个新的请求
+		if group.m[key] == c {
+			delete(group.m, key)
+		}
+		shared = c.dups > 0
+		chans := c.chans
+		group.mu.Unlock()
 
-	return c.val, c.err
+		close(c.done)				// 请求结束
+		for _, ch := range chans {
+			ch <- Result{Val: c.val, Err: c.err, Shared: shared}
+		}
+	}()
+	c.val, c.err = fn()
+	return
 }
@@ -1,13 +1,126 @@
 package singleflight
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+)
 
 func TestDo(t *testing.T)  {
 	var g Group
-	do, err := g.Do("key", func() (interface{}, error) {
+	do, err, _ := g.Do("key", func() (interface{}, error) {
 		return "bar", nil
 	})
 	if do != "bar" || err != nil {
 		t.Errorf("Do v = %v, error = %v", do, err)
 	}
 }
+
+func TestDoContext(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	result := make(chan interface{})
+	go func() {
+		v, _, _ := g.DoContext(context.Background(), "key", func() (interface{}, error) {
+			<-release
+			return "bar", nil
+		})
+		result <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// 等待者超时放弃，不影响共享的调用
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err, _ := g.DoContext(ctx, "key", func() (interface{}, error) {
+		t.Fatal("fn should not be called twice")
+		return nil, nil
+	}); err != context.DeadlineExceeded {
+		t.Fatalf("waiter should give up with deadline exceeded, got %v", err)
+	}
+
+	close(release)
+	if v := <-result; v != "bar" {
+		t.Fatalf("shared call should finish, got %v", v)
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	calls := 0
+	fn := func() (interface{}, error) {
+		calls++
+		<-release
+		return "bar", nil
+	}
+	ch1, leader1 := g.DoChanLeader("key", fn)
+	ch2, leader2 := g.DoChanLeader("key", fn)
+	if !leader1 || leader2 {
+		t.Fatalf("only the first call should run fn, leaders: %v, %v", leader1, leader2)
+	}
+	if n := g.Dups("key"); n != 1 {
+		t.Fatalf("Dups = %d, want 1", n)
+	}
+	close(release)
+	for _, ch := range []<-chan Result{ch1, ch2} {
+		res := <-ch
+		if res.Val != "bar" || res.Err != nil || !res.Shared {
+			t.Fatalf("DoChan result = %+v", res)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("fn called %d times, want 1", calls)
+	}
+
+	if res := <-g.DoChan("key", func() (interface{}, error) { return "baz", nil }); res.Val != "baz" || res.Shared {
+		t.Fatalf("unshared DoChan result = %+v", res)
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	g.Forget("key")
+
+	// Forget 之后的调用不再共享之前的请求
+	if v, _, shared := g.Do("key", func() (interface{}, error) { return 2, nil }); v != 2 || shared {
+		t.Fatalf("Do after Forget = %v, shared = %v", v, shared)
+	}
+	close(release)
+	if res := <-first; res.Val != 1 {
+		t.Fatalf("forgotten call should still finish, got %+v", res)
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	waiter := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		panic("boom")
+	})
+	close(release)
+
+	select {
+	case res := <-waiter:
+		if perr, ok := res.Err.(*PanicError); !ok || perr.Value != "boom" {
+			t.Fatalf("expected PanicError, got %v", res.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter deadlocked after panic")
+	}
+
+	_, err, _ := g.Do("key", func() (interface{}, error) { panic("again") })
+	if _, ok := err.(*PanicError); !ok {
+		t.Fatalf("Do should return PanicError, got %v", err)
+	}
+	// 发生 panic 后 key 不会一直卡住
+	if v, err, _ := g.Do("key", func() (interface{}, error) { return "ok", nil }); v != "ok" || err != nil {
+		t.Fatalf("Do after panic = %v, %v", v, err)
+	}
+}
@@ -0,0 +1,74 @@
+package geecache
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Sink 接收 GetInto 获取到的值，并将其解码为调用方需要的类型
+type Sink interface {
+	// SetView 将值写入 Sink。v 的底层数据与缓存共享，不能被修改，需要保留时应自行拷贝
+	SetView(v ByteView) error
+}
+
+// GetInto 获取 key 的值并写入 sink，解码直接读取缓存中的数据，不会先通过 ByteSlice 拷贝一次
+func (g *Group) GetInto(ctx context.Context, key string, sink Sink) error {
+	v, err := g.GetContext(ctx, key)
+	if err != nil {
+		return err
+	}
+	return sink.SetView(v)
+}
+
+// bytes 返回 v 的底层数据，压缩时返回解压后的数据，调用方不能修改返回值
+func (v ByteView) bytes() []byte {
+	return v.uncompressed().b
+}
+
+// SinkFunc 是实现了 Sink 的函数，便于自定义解码方式
+type SinkFunc func(v ByteView) error
+
+// SetView 调用 f 自身
+func (f SinkFunc) SetView(v ByteView) error {
+	return f(v)
+}
+
+// StringSink 将值保存为字符串
+func StringSink(dst *string) Sink {
+	return SinkFunc(func(v ByteView) error {
+		*dst = v.String()
+		return nil
+	})
+}
+
+// ByteViewSink 直接保存 ByteView，不发生任何拷贝
+func ByteViewSink(dst *ByteView) Sink {
+	return SinkFunc(func(v ByteView) error {
+		*dst = v
+		return nil
+	})
+}
+
+// BytesSink 将值拷贝到 *dst 中，*dst 的容量足够时复用其内存
+func BytesSink(dst *[]byte) Sink {
+	return SinkFunc(func(v ByteView) error {
+		*dst = append((*dst)[:0], v.bytes()...)
+		return nil
+	})
+}
+
+// ProtoSink 将值按 protobuf 解码到 m 中
+func ProtoSink(m proto.Message) Sink {
+	return SinkFunc(func(v ByteView) error {
+		return proto.Unmarshal(v.bytes(), m)
+	})
+}
+
+// JSONSink 将值按 JSON 解码到 dst 中，dst 需为指针
+func JSONSink(dst interface{}) Sink {
+	return SinkFunc(func(v ByteView) error {
+		return json.Unmarshal(v.bytes(), dst)
+	})
+}
@@ -0,0 +1,64 @@
+package geecache
+
+import (
+	"context"
+	pb "geecache/geecachepb"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGetInto(t *testing.T) {
+	encoded, _ := proto.Marshal(&pb.Request{Group: "scores", Key: "Tom"})
+	values := map[string][]byte{
+		"json":  []byte(`{"name":"Tom","score":630}`),
+		"proto": encoded,
+	}
+	group := NewGroup("sink", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := values[key]; ok {
+				return v, nil
+			}
+			return nil, &NotFoundError{Key: key}
+		}))
+	ctx := context.Background()
+
+	var s string
+	if err := group.GetInto(ctx, "json", StringSink(&s)); err != nil || s != string(values["json"]) {
+		t.Fatalf("StringSink = %q, %v", s, err)
+	}
+
+	var score struct {
+		Name  string `json:"name"`
+		Score int    `json:"score"`
+	}
+	if err := group.GetInto(ctx, "json", JSONSink(&score)); err != nil || score.Name != "Tom" || score.Score != 630 {
+		t.Fatalf("JSONSink = %+v, %v", score, err)
+	}
+
+	req := &pb.Request{}
+	if err := group.GetInto(ctx, "proto", ProtoSink(req)); err != nil || req.GetKey() != "Tom" {
+		t.Fatalf("ProtoSink = %v, %v", req, err)
+	}
+	if err := group.GetInto(ctx, "json", ProtoSink(&pb.Request{})); err == nil {
+		t.Fatal("decoding JSON as protobuf should fail")
+	}
+
+	// BytesSink 复用 dst 的内存，修改 dst 不会影响缓存
+	buf := make([]byte, 0, 64)
+	if err := group.GetInto(ctx, "json", BytesSink(&buf)); err != nil || string(buf) != string(values["json"]) {
+		t.Fatalf("BytesSink = %q, %v", buf, err)
+	}
+	if cap(buf) != 64 {
+		t.Fatal("BytesSink should reuse the buffer")
+	}
+	buf[0] = 'x'
+	var v ByteView
+	if err := group.GetInto(ctx, "json", ByteViewSink(&v)); err != nil || v.String() != string(values["json"]) {
+		t.Fatalf("ByteViewSink = %q, %v", v.String(), err)
+	}
+
+	if err := group.GetInto(ctx, "unknown", StringSink(&s)); !IsNotFound(err) {
+		t.Fatalf("expect NotFoundError, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package geecache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+/*
+快照用于节点重启后预热 mainCache，避免重启后所有请求都落到数据源上。
+hotCache 与 missCache 只是短期的副本，不会写入快照。
+
+快照格式（整数均为 varint 编码）：
+
+	| magic "GEES" | version (1 字节) | 元素个数 |
+	| key 长度 | key | value 长度 | value | 过期时间 (UnixNano，0 表示永不过期) | ...
+
+元素按淘汰顺序排列，最先被淘汰的在前，Restore 按顺序加入即可还原 LRU 顺序。
+*/
+
+const (
+	snapshotMagic   = "GEES"
+	snapshotVersion = 1
+	// snapshotMaxLen 限制快照中单个 key 或 value 的长度，防止损坏的快照导致分配过多内存
+	snapshotMaxLen = 64 << 20
+)
+
+var errBadSnapshot = errors.New("geecache: invalid snapshot")
+
+// Snapshot 将 mainCache 中所有未过期的值写入 w
+func (g *Group) Snapshot(w io.Writer) error {
+	entries := g.mainCache.entries()
+	bw := bufio.NewWriter(w)
+	bw.WriteString(snapshotMagic)
+	bw.WriteByte(snapshotVersion)
+
+	var buf [binary.MaxVarintLen64]byte
+	putUvarint := func(x uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf[:], x)])
+	}
+	putUvarint(uint64(len(entries)))
+	for _, e := range entries {
+		putUvarint(uint64(len(e.key)))
+		bw.WriteString(e.key)
+		putUvarint(uint64(e.value.Len()))
+		bw.Write(e.value.b)
+		var expire int64
+		if !e.expire.IsZero() {
+			expire = e.expire.UnixNano()
+		}
+		bw.Write(buf[:binary.PutVarint(buf[:], expire)])
+	}
+	return bw.Flush()
+}
+
+// Restore 从 r 中读取 Snapshot 写入的快照并加入 mainCache，已经过期的值会被跳过。
+// 快照格式错误时返回错误，此前读到的值仍会保留在缓存中。
+func (g *Group) Restore(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0, fmt.Errorf("reading snapshot header: %v", err)
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return 0, errBadSnapshot
+	}
+	if version := header[len(snapshotMagic)]; version != snapshotVersion {
+		return 0, fmt.Errorf("geecache: unsupported snapshot version %d", version)
+	}
+
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, fmt.Errorf("reading snapshot: %v", err)
+	}
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n > snapshotMaxLen {
+			return nil, errBadSnapshot
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(br, b)
+		return b, err
+	}
+
+	now := time.Now()
+	restored := 0
+	for i := uint64(0); i < count; i++ {
+		key, err := readBytes()
+		if err != nil {
+			return restored, fmt.Errorf("reading snapshot: %v", err)
+		}
+		value, err := readBytes()
+		if err != nil {
+			return restored, fmt.Errorf("reading snapshot: %v", err)
+		}
+		nanos, err := binary.ReadVarint(br)
+		if err != nil {
+			return restored, fmt.Errorf("reading snapshot: %v", err)
+		}
+		var expire time.Time
+		if nanos != 0 {
+			expire = time.Unix(0, nanos)
+			if !now.Before(expire) {
+				continue
+			}
+		}
+		g.mainCache.addWithRefresh(string(key), ByteView{b: value}, expire, g.refreshAt(expire))
+		restored++
+	}
+	return restored, nil
+}
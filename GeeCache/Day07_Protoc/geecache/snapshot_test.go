@@ -0,0 +1,67 @@
+package geecache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	})
+	src := NewGroup("snapshot-src", 2<<10, getter)
+	for _, key := range []string{"k1", "k2", "k3"} {
+		src.Get(key)
+	}
+	src.Get("k1") // k1 变为最近访问，k2 成为最久未访问
+	src.mainCache.add("expired", ByteView{b: []byte("x")}, time.Now().Add(time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// 容量只够三个值，还原后再加入一个值时应当淘汰 k2
+	size := int64(len("k1") + len("v-k1"))
+	dst := NewGroup("snapshot-dst", 3*size, getter)
+	n, err := dst.Restore(&buf)
+	if err != nil || n != 3 {
+		t.Fatalf("restored %d entries, err = %v", n, err)
+	}
+	dst.mainCache.add("k4", ByteView{b: []byte("v-k4")}, time.Time{})
+	if _, ok := dst.mainCache.get("k2"); ok {
+		t.Fatal("k2 should be the oldest entry after restore")
+	}
+	for _, key := range []string{"k1", "k3", "k4"} {
+		if v, ok := dst.mainCache.get(key); !ok || v.String() != "v-"+key {
+			t.Fatalf("%s not restored, got %q", key, v.String())
+		}
+	}
+
+	// 开启 WithSoftTTL 时还原的值同样会软过期
+	var snap bytes.Buffer
+	src.Snapshot(&snap)
+	soft := NewGroup("snapshot-soft", 2<<10, getter, WithSoftTTL(time.Millisecond))
+	soft.Restore(&snap)
+	time.Sleep(5 * time.Millisecond)
+	if _, stale, ok := soft.mainCache.getStale("k1"); !ok || !stale {
+		t.Fatal("restored entries should get a soft TTL")
+	}
+}
+
+func TestRestoreBadSnapshot(t *testing.T) {
+	g := NewGroup("snapshot-bad", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, nil
+	}))
+	if _, err := g.Restore(bytes.NewReader([]byte("nope!"))); err == nil {
+		t.Fatal("expected error for bad magic")
+	}
+	if _, err := g.Restore(bytes.NewReader([]byte(snapshotMagic + "\x09"))); err == nil {
+		t.Fatal("expected error for unknown version")
+	}
+	if _, err := g.Restore(bytes.NewReader([]byte(snapshotMagic + "\x01\x02\x01k"))); err == nil {
+		t.Fatal("expected error for truncated snapshot")
+	}
+}
@@ -0,0 +1,89 @@
+package geecache
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// AtomicInt 是一个支持原子操作的 int64，用于并发地统计各项指标
+type AtomicInt int64
+
+// Add atomically adds n to i.
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get atomically gets the value of i.
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// Stats 是 Group 级别的统计信息
+type Stats struct {
+	Gets           AtomicInt	// 所有 Get 请求，包括来自其他节点的请求
+	CacheHits      AtomicInt	// mainCache 或 hotCache 命中
+	StaleHits      AtomicInt	// 命中已软过期的值，返回旧值并在后台刷新，同时计入 CacheHits
+	Refreshes      AtomicInt	// 后台刷新的次数
+	RefreshErrors  AtomicInt	// 后台刷新失败的次数，失败时旧值保留到硬过期
+	NegativeHits   AtomicInt	// missCache 命中，直接返回 NotFoundError
+	PeerLoads      AtomicInt	// 从远程节点成功获取
+	PeerErrors     AtomicInt	// 从远程节点获取失败
+	Loads          AtomicInt	// 缓存未命中，需要加载
+	LoadsDeduped   AtomicInt	// 被 singleflight 合并，与其他请求共享结果的加载
+	LocalLoads     AtomicInt	// 通过 Getter 成功加载
+	LocalLoadErrs  AtomicInt	// 通过 Getter 加载失败
+	ServerRequests AtomicInt	// 通过 HTTP 收到的来自其他节点的请求
+}
+
+// GroupStats 是某个 Group 统计信息的快照，用于序列化成 JSON
+type GroupStats struct {
+	Name           string     `json:"name"`
+	Gets           int64      `json:"gets"`
+	CacheHits      int64      `json:"cache_hits"`
+	HitRatio       float64    `json:"hit_ratio"`
+	StaleHits      int64      `json:"stale_hits"`
+	Refreshes      int64      `json:"refreshes"`
+	RefreshErrors  int64      `json:"refresh_errors"`
+	NegativeHits   int64      `json:"negative_hits"`
+	PeerLoads      int64      `json:"peer_loads"`
+	PeerErrors     int64      `json:"peer_errors"`
+	Loads          int64      `json:"loads"`
+	LoadsDeduped   int64      `json:"loads_deduped"`
+	LocalLoads     int64      `json:"local_loads"`
+	LocalLoadErrs  int64      `json:"local_load_errs"`
+	ServerRequests int64      `json:"server_requests"`
+	MainCache      CacheStats `json:"main_cache"`
+	HotCache       CacheStats `json:"hot_cache"`
+	MissCache      CacheStats `json:"miss_cache"`
+}
+
+// StatsSnapshot 返回 Group 当前统计信息的快照
+func (g *Group) StatsSnapshot() GroupStats {
+	s := GroupStats{
+		Name:           g.name,
+		Gets:           g.Stats.Gets.Get(),
+		CacheHits:      g.Stats.CacheHits.Get(),
+		StaleHits:      g.Stats.StaleHits.Get(),
+		Refreshes:      g.Stats.Refreshes.Get(),
+		RefreshErrors:  g.Stats.RefreshErrors.Get(),
+		NegativeHits:   g.Stats.NegativeHits.Get(),
+		PeerLoads:      g.Stats.PeerLoads.Get(),
+		PeerErrors:     g.Stats.PeerErrors.Get(),
+		Loads:          g.Stats.Loads.Get(),
+		LoadsDeduped:   g.Stats.LoadsDeduped.Get(),
+		LocalLoads:     g.Stats.LocalLoads.Get(),
+		LocalLoadErrs:  g.Stats.LocalLoadErrs.Get(),
+		ServerRequests: g.Stats.ServerRequests.Get(),
+		MainCache:      g.CacheStats(MainCache),
+		HotCache:       g.CacheStats(HotCache),
+		MissCache:      g.CacheStats(MissCache),
+	}
+	if s.Gets > 0 {
+		s.HitRatio = float64(s.CacheHits) / float64(s.Gets)
+	}
+	return s
+}
@@ -0,0 +1,237 @@
+package twoq
+
+import (
+	"container/list"
+	"time"
+
+	"geecache/lru"
+)
+
+// Value 与 lru.Value 相同，使得各淘汰策略可以实现同一个接口
+type Value = lru.Value
+
+const (
+	// RecentRatio 是 recent 队列最多占用内存的比例
+	RecentRatio = 0.25
+	// GhostRatio 是 ghost 队列记录的已淘汰 key 占用内存的比例
+	GhostRatio = 0.5
+)
+
+// Cache 是 2Q 缓存。新加入的元素先进入 recent 队列，只有再次被访问时才会晋升到 frequent 队列，
+// 因此一次性的扫描只会冲刷 recent 队列，而不会淘汰 frequent 中的热点数据。
+// 从 recent 淘汰的 key 会被记录在 ghost 队列中，如果很快又被加入则直接进入 frequent。
+type Cache struct {
+	maxBytes		int64		// 允许使用最大内存
+	recentBytes		int64		// recent 已经使用的内存
+	frequentBytes	int64		// frequent 已经使用的内存
+	ghostBytes		int64		// ghost 中记录的 key 在淘汰前占用的内存
+	recent			*list.List	// 只被访问过一次的元素，队首为最新的
+	frequent		*list.List	// 被访问过多次的元素，队首为最新的
+	ghost			*list.List	// 最近从 recent 淘汰的 key，只记录 key 不记录值
+	cache			map[string]*list.Element	// recent 与 frequent 中的元素
+	ghosts			map[string]*list.Element
+	OnEvicted		func(key string, value Value)	//	如果回调函数 OnEvicted 不为 nil，则调用回调函数。
+}
+
+type entry struct {
+	key			string
+	value		Value
+	expire		time.Time	// 过期时间，零值表示永不过期
+	frequent	bool		// 是否在 frequent 队列中
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key)) + int64(e.value.Len())
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+type ghostEntry struct {
+	key		string
+	size	int64
+}
+
+// now 便于测试时替换时间源
+var now = time.Now
+
+// New 实例化
+func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		recent:    list.New(),
+		frequent:  list.New(),
+		ghost:     list.New(),
+		cache:     make(map[string]*list.Element),
+		ghosts:    make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Get 查找 key，recent 中的元素被再次访问时晋升到 frequent
+func (c *Cache) Get(key string) (val Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		if kv.expired(now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		c.promote(ele)
+		return kv.value, true
+	}
+	return
+}
+
+// Add : add or modify
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 与 Add 相同，但会为 key 设置过期时间，expire 为零值时表示永不过期
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.addBytes(kv, int64(value.Len())-int64(kv.value.Len()))
+		kv.value = value
+		kv.expire = expire
+		c.promote(ele)
+	} else {
+		kv := &entry{key: key, value: value, expire: expire}
+		// 最近刚被淘汰过的 key，说明并非一次性访问，直接进入 frequent
+		if g, ok := c.ghosts[key]; ok {
+			c.removeGhost(g)
+			kv.frequent = true
+			c.cache[key] = c.frequent.PushFront(kv)
+		} else {
+			c.cache[key] = c.recent.PushFront(kv)
+		}
+		c.addBytes(kv, kv.size())
+	}
+	for c.maxBytes != 0 && c.recentBytes+c.frequentBytes > c.maxBytes {
+		c.RemoveOldest()
+	}
+}
+
+// SetMaxBytes 修改允许使用的最大内存，缩小时立即淘汰多出的元素并收缩 ghost 队列，0 表示不限制
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	for c.maxBytes != 0 && c.recentBytes+c.frequentBytes > c.maxBytes {
+		c.RemoveOldest()
+	}
+	for c.ghost.Len() > 0 && float64(c.ghostBytes) > float64(c.maxBytes)*GhostRatio {
+		c.removeGhost(c.ghost.Back())
+	}
+}
+
+// RemoveOldest 淘汰一个元素：recent 超出配额时淘汰 recent 队尾，否则淘汰 frequent 队尾
+func (c *Cache) RemoveOldest() {
+	if c.recent.Len() > 0 &&
+		(float64(c.recentBytes) > float64(c.maxBytes)*RecentRatio || c.frequent.Len() == 0) {
+		ele := c.recent.Back()
+		kv := ele.Value.(*entry)
+		c.removeElement(ele)
+		c.addGhost(kv.key, kv.size())
+		return
+	}
+	if ele := c.frequent.Back(); ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+// Remove 删除指定 key，返回 key 是否存在
+func (c *Cache) Remove(key string) bool {
+	if g, ok := c.ghosts[key]; ok {
+		c.removeGhost(g)
+	}
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired 删除所有已过期的元素，返回删除的个数
+func (c *Cache) RemoveExpired() int {
+	cur := now()
+	removed := 0
+	for _, ele := range c.cache {
+		if ele.Value.(*entry).expired(cur) {
+			c.removeElement(ele)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Walk 先遍历 recent 再遍历 frequent，每个队列都从最久未访问的元素开始。
+// 遍历过程中不能修改 Cache
+func (c *Cache) Walk(fn func(key string, value Value, expire time.Time)) {
+	for _, l := range []*list.List{c.recent, c.frequent} {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			fn(kv.key, kv.value, kv.expire)
+		}
+	}
+}
+
+// Bytes 返回当前已经使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.recentBytes + c.frequentBytes
+}
+
+// Len 返回元素个数
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// promote 将元素移动到 frequent 队首
+func (c *Cache) promote(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.frequent {
+		c.frequent.MoveToFront(ele)
+		return
+	}
+	c.recent.Remove(ele)
+	c.recentBytes -= kv.size()
+	kv.frequent = true
+	c.cache[kv.key] = c.frequent.PushFront(kv)
+	c.frequentBytes += kv.size()
+}
+
+func (c *Cache) addBytes(kv *entry, delta int64) {
+	if kv.frequent {
+		c.frequentBytes += delta
+	} else {
+		c.recentBytes += delta
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.frequent {
+		c.frequent.Remove(ele)
+	} else {
+		c.recent.Remove(ele)
+	}
+	c.addBytes(kv, -kv.size())
+	delete(c.cache, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) addGhost(key string, size int64) {
+	c.ghosts[key] = c.ghost.PushFront(&ghostEntry{key: key, size: size})
+	c.ghostBytes += size
+	for float64(c.ghostBytes) > float64(c.maxBytes)*GhostRatio {
+		c.removeGhost(c.ghost.Back())
+	}
+}
+
+func (c *Cache) removeGhost(ele *list.Element) {
+	g := ele.Value.(*ghostEntry)
+	c.ghost.Remove(ele)
+	delete(c.ghosts, g.key)
+	c.ghostBytes -= g.size
+}
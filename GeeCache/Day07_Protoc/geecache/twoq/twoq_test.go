@@ -0,0 +1,54 @@
+package twoq
+
+import (
+	"fmt"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestScanResistant(t *testing.T) {
+	// 每个元素占用 4 字节，最多容纳 10 个
+	c := New(int64(40), nil)
+	hot := []string{"h1", "h2", "h3", "h4", "h5"}
+	for _, k := range hot {
+		c.Add(k, String("vv"))
+		c.Get(k)
+	}
+
+	// 一次性扫描大量只访问一次的 key
+	for i := 0; i < 100; i++ {
+		c.Add(fmt.Sprintf("s%d", i%100), String(fmt.Sprintf("%d", i%10)))
+	}
+
+	for _, k := range hot {
+		if _, ok := c.Get(k); !ok {
+			t.Fatalf("hot key %s should survive the scan", k)
+		}
+	}
+	if c.Bytes() > 40 {
+		t.Fatalf("used bytes %d exceed max bytes", c.Bytes())
+	}
+}
+
+func TestGhost(t *testing.T) {
+	c := New(int64(16), nil)
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		c.Add(k, String("vv"))
+	}
+	// k1 已从 recent 淘汰并记录在 ghost 中，再次加入直接进入 frequent
+	if _, ok := c.ghosts["k1"]; !ok {
+		t.Fatal("k1 should be recorded in ghost")
+	}
+	c.Add("k1", String("vv"))
+	if ele, ok := c.cache["k1"]; !ok || !ele.Value.(*entry).frequent {
+		t.Fatal("k1 should be added to frequent")
+	}
+	if !c.Remove("k1") || c.Len() != 3 {
+		t.Fatalf("remove k1 failed, len: %d", c.Len())
+	}
+}
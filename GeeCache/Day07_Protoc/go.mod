@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	geecache v0.0.0
+	google.golang.org/protobuf v1.27.1
 )
 
 replace (
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"geecache"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var db = map[string]string{
@@ -22,26 +28,169 @@ func createGroup() *geecache.Group {
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}))
+			return nil, &geecache.NotFoundError{Key: key}
+		}), geecache.WithTTL(time.Minute))
+}
+
+// loadSnapshot 启动时从快照文件预热缓存，文件不存在时忽略
+func loadSnapshot(path string, gee *geecache.Group) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Println("[loadSnapshot] open snapshot failed:", err)
+		return
+	}
+	defer f.Close()
+	n, err := gee.Restore(f)
+	if err != nil {
+		log.Println("[loadSnapshot] restore snapshot failed:", err)
+	}
+	log.Printf("[loadSnapshot] restored %d keys from %s", n, path)
+}
+
+// saveSnapshot 将缓存写入快照文件，先写临时文件再重命名，避免中途退出留下不完整的快照
+func saveSnapshot(path string, gee *geecache.Group) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gee.Snapshot(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// saveSnapshotOnExit 收到退出信号时保存快照后退出
+func saveSnapshotOnExit(path string, gee *geecache.Group) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		if err := saveSnapshot(path, gee); err != nil {
+			log.Println("[saveSnapshot] save snapshot failed:", err)
+			os.Exit(1)
+		}
+		log.Println("[saveSnapshot] snapshot saved to", path)
+		os.Exit(0)
+	}()
 }
 
 // startCacheServer() 用来启动缓存服务器：创建 HTTPPool，添加节点信息，注册到 gee 中，
 // 启动 HTTP 服务（共3个端口，8001/8002/8003），用户不感知。
-func startCacheServer(addr string, addrs []string, gee *geecache.Group)  {
-	peers := geecache.NewHTTPPool(addr)
-	peers.Set(addrs...)
+// peersFile 不为空时，节点列表从该文件中读取并定期刷新，可以在运行时增删节点。
+// replication 大于 1 时每个 key 保存在 replication 个节点上，写入同时更新所有副本。
+// secret 不为空时节点间的请求使用该密钥签名，未签名的请求返回 401。
+// tlsConfig 不为 nil 时节点间使用双向 TLS，地址为 https://，包括 peersFile 中读取的地址。
+func startCacheServer(addr string, addrs []string, peersFile string, replication int, secret string, tlsConfig *tls.Config, gee *geecache.Group)  {
+	opts := []geecache.HTTPPoolOption{geecache.WithReplication(replication, true)}
+	var src geecache.PeerSource
+	if peersFile != "" {
+		src = geecache.FilePeers(peersFile)
+	}
+	if secret != "" {
+		opts = append(opts, geecache.WithSharedSecret([]byte(secret)))
+	}
+	if tlsConfig != nil {
+		opts = append(opts, geecache.WithTLS(tlsConfig))
+		addr = toHTTPS(addr)
+		for i := range addrs {
+			addrs[i] = toHTTPS(addrs[i])
+		}
+		if src != nil {
+			src = mappedPeers{src: src, fn: toHTTPS}
+		}
+	}
+	peers := geecache.NewHTTPPool(addr, opts...)
+	if src != nil {
+		// 每次重新读取文件时都会转换地址，运行时加入的节点同样使用 https://
+		peers.WatchPeers(src, 5*time.Second)
+	} else {
+		peers.Set(addrs...)
+	}
 	gee.RegisterPeers(peers)
 	log.Println("[startCacheServer] geecache is running at", addr)
+	if tlsConfig != nil {
+		server := &http.Server{Addr: strings.TrimPrefix(addr, "https://"), Handler: peers, TLSConfig: tlsConfig}
+		log.Fatal(server.ListenAndServeTLS("", ""))
+	}
 	log.Fatal(http.ListenAndServe(addr[7:], peers))	// Fatal等价于{l.Print(v...); os.Exit(1)}
 }
 
+// toHTTPS 将 http:// 开头的地址改为 https://，已经是 https:// 的地址保持不变
+func toHTTPS(addr string) string {
+	if strings.HasPrefix(addr, "https://") {
+		return addr
+	}
+	return "https://" + strings.TrimPrefix(addr, "http://")
+}
+
+// mappedPeers 对 src 返回的每个节点地址调用 fn，使 -peers 文件中的地址与节点使用的格式一致
+type mappedPeers struct {
+	src geecache.PeerSource
+	fn  func(addr string) string
+}
+
+func (m mappedPeers) Peers() ([]string, error) {
+	peers, err := m.src.Peers()
+	if err != nil {
+		return nil, err
+	}
+	for i := range peers {
+		peers[i] = m.fn(peers[i])
+	}
+	return peers, nil
+}
+
+// toRPC 去掉地址的 http:// 前缀，得到 RPCPool 使用的 host:port
+func toRPC(addr string) string {
+	return strings.TrimPrefix(addr, "http://")
+}
+
+// startRPCCacheServer() 与 startCacheServer() 类似，但节点间通过长连接的 RPCPool 通信，地址不带 http:// 前缀。
+// peersFile 不为空时，节点列表从该文件中读取并定期刷新，文件中的地址与 HTTP 节点相同。
+// secret 不为空时连接建立后先完成认证，tlsConfig 不为 nil 时连接使用双向 TLS。
+func startRPCCacheServer(addr string, addrs []string, peersFile string, secret string, tlsConfig *tls.Config, gee *geecache.Group)  {
+	var opts []geecache.RPCPoolOption
+	if secret != "" {
+		opts = append(opts, geecache.WithRPCSharedSecret([]byte(secret)))
+	}
+	if tlsConfig != nil {
+		opts = append(opts, geecache.WithRPCTLS(tlsConfig))
+	}
+	peers := geecache.NewRPCPool(toRPC(addr), opts...)
+	if peersFile != "" {
+		peers.WatchPeers(mappedPeers{src: geecache.FilePeers(peersFile), fn: toRPC}, 5*time.Second)
+	} else {
+		rpcAddrs := make([]string, 0, len(addrs))
+		for _, a := range addrs {
+			rpcAddrs = append(rpcAddrs, toRPC(a))
+		}
+		peers.Set(rpcAddrs...)
+	}
+	gee.RegisterPeers(peers)
+	log.Println("[startRPCCacheServer] geecache is running at", toRPC(addr))
+	log.Fatal(peers.ListenAndServe())
+}
+
 // startAPIServer() 用来启动一个 API 服务（端口 9999），与用户进行交互，用户感知。
 func startAPIServer(apiAddr string, gee *geecache.Group)  {
 	http.Handle("/api", http.HandlerFunc(
 		func(writer http.ResponseWriter, request *http.Request) {
 			key := request.URL.Query().Get("key")
-			view, err := gee.Get(key)
+			view, err := gee.GetContext(request.Context(), key)
+			if geecache.IsNotFound(err) {
+				http.Error(writer, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(writer, err.Error(), http.StatusInternalServerError)
 				return
@@ -57,10 +206,41 @@ func main() {
 	// 传入 port 和 api 2 个参数，用来在指定端口启动 HTTP 服务。
 	var port int
 	var api bool
+	var transport string
+	var peersFile string
+	var snapshot string
+	var replication int
+	var secret string
+	var certFile, keyFile, caFile string
+	var insecure bool
 	flag.IntVar(&port, "port", 8001, "Cache Server port")
 	flag.BoolVar(&api, "api", false, "Start a Api impServer")
+	flag.StringVar(&transport, "transport", "http", "Peer transport: http or rpc")
+	flag.StringVar(&peersFile, "peers", "", "File listing peer addresses, one per line")
+	flag.StringVar(&snapshot, "snapshot", "", "Snapshot file loaded at startup and written on shutdown")
+	flag.IntVar(&replication, "replication", 1, "Number of nodes each key is stored on, http transport only")
+	flag.StringVar(&secret, "secret", os.Getenv("GEECACHE_SECRET"), "Shared secret used to sign peer requests")
+	flag.StringVar(&certFile, "cert", "", "Certificate of this node for mutual TLS between peers")
+	flag.StringVar(&keyFile, "key", "", "Private key of -cert")
+	flag.StringVar(&caFile, "ca", "", "CA certificate that signed the certificates of all peers")
+	flag.BoolVar(&insecure, "insecure", false, "Allow -secret over plain connections, where traffic can be read and http requests replayed")
 	flag.Parse()
 
+	// RPCPool 不支持复制，不能静默地忽略 -replication
+	if transport == "rpc" && replication > 1 {
+		log.Fatal("-replication is not supported with -transport rpc")
+	}
+	// 签名与认证都不加密内容，只在 TLS 或明确允许时用于明文连接
+	var tlsConfig *tls.Config
+	if certFile != "" {
+		var err error
+		if tlsConfig, err = geecache.MutualTLSConfig(certFile, keyFile, caFile); err != nil {
+			log.Fatal(err)
+		}
+	} else if secret != "" && !insecure {
+		log.Fatal("-secret requires -cert, -key and -ca, or -insecure to authenticate peers over plain connections")
+	}
+
 	// 作为多个节点
 	serverAddrMap := map[int]string{
 		8001: "http://localhost:8001",
@@ -75,10 +255,18 @@ func main() {
 	}
 
 	geeGroup := createGroup()
+	if snapshot != "" {
+		loadSnapshot(snapshot, geeGroup)
+		saveSnapshotOnExit(snapshot, geeGroup)
+	}
 	if api {
 		go startAPIServer(apiAddr, geeGroup)
 	}
-	startCacheServer(serverAddrMap[port], serverAddrs, geeGroup)
+	if transport == "rpc" {
+		startRPCCacheServer(serverAddrMap[port], serverAddrs, peersFile, secret, tlsConfig, geeGroup)
+		return
+	}
+	startCacheServer(serverAddrMap[port], serverAddrs, peersFile, replication, secret, tlsConfig, geeGroup)
 }
 
 func httpEscape()  {